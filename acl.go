@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+// ACLEntry grants a permission on a single resource to a user or to the members of a group
+type ACLEntry struct {
+	ID           int64
+	PermissionID int64
+	Permission   string `db:"-"` // permission name
+	ResourceType string
+	ResourceID   string
+	UserID       *int64
+	GroupID      *int64
+	CreatedAt    time.Time `db:"created_at,ro"`
+}
+
+func (*ACLEntry) TableName() string {
+	return "acl_entries"
+}
+
+// ACLRepo manages permissions on specific resources such as "edit" on post 42.
+// Entries granted to a group apply to its members and the members of its subgroups.
+type ACLRepo struct {
+	db    orm.DB
+	audit *AuditRepo
+	actor *Session
+}
+
+func NewACLRepo(db orm.DB) *ACLRepo {
+	return &ACLRepo{db: db}
+}
+
+// As returns a copy of the repo whose actions are attributed to the session in the audit log
+func (r *ACLRepo) As(sess *Session) *ACLRepo {
+	c := *r
+	c.actor = sess
+	return &c
+}
+
+// GrantUser grants the permission on the resource to the user.
+// No error will occur if the user already has the permission on the resource.
+func (r *ACLRepo) GrantUser(uid int64, perm, resourceType, resourceID string) error {
+	return r.grant(&ACLEntry{Permission: perm, ResourceType: resourceType, ResourceID: resourceID, UserID: &uid})
+}
+
+// GrantGroup grants the permission on the resource to the members of the group.
+// No error will occur if the group already has the permission on the resource.
+func (r *ACLRepo) GrantGroup(gid int64, perm, resourceType, resourceID string) error {
+	return r.grant(&ACLEntry{Permission: perm, ResourceType: resourceType, ResourceID: resourceID, GroupID: &gid})
+}
+
+func (r *ACLRepo) grant(e *ACLEntry) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := tx.QueryRow("select id from permissions where name = $1", e.Permission).Scan(&e.PermissionID); err != nil {
+		if errors.Is(err, orm.ErrNotFound) {
+			return ErrPermissionNotFound
+		}
+
+		return err
+	}
+
+	res, err := tx.Exec(`insert into acl_entries (permission_id, resource_type, resource_id, user_id, group_id)
+		values ($1, $2, $3, $4, $5) on conflict do nothing`, e.PermissionID, e.ResourceType, e.ResourceID, e.UserID, e.GroupID)
+
+	if isForeignKeyViolation(err, "acl_entries_user_id_fkey") {
+		return ErrUserNotFound
+	}
+
+	if isForeignKeyViolation(err, "acl_entries_group_id_fkey") {
+		return ErrGroupNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	if err := r.audit.add(tx, NewAuditEntry(r.actor, AuditACLGranted, e.UserID, e.auditMeta())); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeUser revokes the permission on the resource granted to the user.
+// Permissions the user has through their groups are not affected.
+func (r *ACLRepo) RevokeUser(uid int64, perm, resourceType, resourceID string) error {
+	return r.revoke(&ACLEntry{Permission: perm, ResourceType: resourceType, ResourceID: resourceID, UserID: &uid})
+}
+
+// RevokeGroup revokes the permission on the resource granted to the group
+func (r *ACLRepo) RevokeGroup(gid int64, perm, resourceType, resourceID string) error {
+	return r.revoke(&ACLEntry{Permission: perm, ResourceType: resourceType, ResourceID: resourceID, GroupID: &gid})
+}
+
+func (r *ACLRepo) revoke(e *ACLEntry) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`delete from acl_entries a using permissions p
+		where p.id = a.permission_id and p.name = $1 and a.resource_type = $2 and a.resource_id = $3
+		and a.user_id is not distinct from $4 and a.group_id is not distinct from $5`,
+		e.Permission, e.ResourceType, e.ResourceID, e.UserID, e.GroupID)
+
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	if err := r.audit.add(tx, NewAuditEntry(r.actor, AuditACLRevoked, e.UserID, e.auditMeta())); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveResource removes all entries of a resource, call it when the resource is deleted
+func (r *ACLRepo) RemoveResource(resourceType, resourceID string) error {
+	return orm.Exec(r.db, "delete from acl_entries where resource_type = $1 and resource_id = $2", resourceType, resourceID)
+}
+
+// Entries returns the entries of a resource ordered by permission name
+func (r *ACLRepo) Entries(resourceType, resourceID string) ([]ACLEntry, error) {
+	cols := orm.Columns(&ACLEntry{}).PrefixedList("a")
+	rows, err := r.db.Query(`select `+cols+`, p.name from acl_entries a
+		inner join permissions p on p.id = a.permission_id
+		where a.resource_type = $1 and a.resource_id = $2 order by p.name, a.id`, resourceType, resourceID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []ACLEntry
+	for rows.Next() {
+		var e ACLEntry
+		if err := rows.Scan(&e.ID, &e.PermissionID, &e.ResourceType, &e.ResourceID, &e.UserID, &e.GroupID, &e.CreatedAt, &e.Permission); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// Can returns true when the user was granted the permission on the resource directly or through a group
+func (r *ACLRepo) Can(uid int64, perm, resourceType, resourceID string) (bool, error) {
+	var can bool
+	row := r.db.QueryRow(userGroupsCTE+`
+	select exists (
+		select 1 from acl_entries a
+		inner join permissions p on p.id = a.permission_id
+		where p.name = $2 and a.resource_type = $3 and a.resource_id = $4
+		and (a.user_id = $1 or a.group_id in (select id from user_groups))
+	)`, uid, perm, resourceType, resourceID)
+
+	if err := row.Scan(&can); err != nil {
+		return false, err
+	}
+
+	return can, nil
+}
+
+// ListResources returns the ids of the resources of a type the user was granted the permission on,
+// for filtering queries with "where id = any($1)"
+func (r *ACLRepo) ListResources(uid int64, perm, resourceType string) ([]string, error) {
+	rows, err := r.db.Query(userGroupsCTE+`
+	select distinct a.resource_id from acl_entries a
+	inner join permissions p on p.id = a.permission_id
+	where p.name = $2 and a.resource_type = $3
+	and (a.user_id = $1 or a.group_id in (select id from user_groups))
+	order by a.resource_id`, uid, perm, resourceType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (e *ACLEntry) auditMeta() map[string]any {
+	return map[string]any{
+		"permission":    e.Permission,
+		"resource_type": e.ResourceType,
+		"resource_id":   e.ResourceID,
+		"user_id":       e.UserID,
+		"group_id":      e.GroupID,
+	}
+}
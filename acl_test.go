@@ -0,0 +1,77 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/cristosal/auth"
+)
+
+func TestACL(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	groups := []auth.Group{{Name: "acl_editors", Description: "editors"}}
+	perm := auth.Permission{Name: "acl_edit"}
+
+	t.Cleanup(func() {
+		svc.Groups().Remove(groups[0].ID)
+		svc.Permissions().RemoveByName(perm.Name)
+	})
+
+	if err := svc.Groups().Seed(groups); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Permissions().Add(&perm); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := svc.Users().Register(&auth.RegistrationRequest{Name: "ACL User", Email: "acl@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		svc.EraseUser(res.UserID)
+	})
+
+	acl := svc.ACL()
+	if err := acl.GrantUser(res.UserID, perm.Name, "post", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := acl.GrantGroup(groups[0].ID, perm.Name, "post", "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if can, err := acl.Can(res.UserID, perm.Name, "post", "2"); err != nil || can {
+		t.Fatalf("expected no access before joining group got %v %v", can, err)
+	}
+
+	if err := svc.Groups().AddUser(res.UserID, groups[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := acl.ListResources(res.UserID, perm.Name, "post")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+		t.Fatalf("expected posts 1 and 2 got %v", ids)
+	}
+
+	if err := acl.RevokeUser(res.UserID, perm.Name, "post", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if can, err := acl.Can(res.UserID, perm.Name, "post", "1"); err != nil || can {
+		t.Fatalf("expected access to be revoked got %v %v", can, err)
+	}
+
+	if err := acl.RemoveResource("post", "2"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// AttributeSchema validates user attributes using a subset of JSON Schema.
+// Supported keywords are type, properties, required, additionalProperties,
+// enum, minLength, maxLength, pattern, minimum, maximum and items.
+type AttributeSchema struct {
+	Type                 string                      `json:"type,omitempty"`
+	Properties           map[string]*AttributeSchema `json:"properties,omitempty"`
+	Required             []string                    `json:"required,omitempty"`
+	AdditionalProperties *bool                       `json:"additionalProperties,omitempty"`
+	Enum                 []any                       `json:"enum,omitempty"`
+	MinLength            *int                        `json:"minLength,omitempty"`
+	MaxLength            *int                        `json:"maxLength,omitempty"`
+	Pattern              string                      `json:"pattern,omitempty"`
+	Minimum              *float64                    `json:"minimum,omitempty"`
+	Maximum              *float64                    `json:"maximum,omitempty"`
+	Items                *AttributeSchema            `json:"items,omitempty"`
+
+	once    sync.Once
+	err     error
+	pattern *regexp.Regexp
+}
+
+// AttributeError describes why attributes did not match the schema
+type AttributeError struct {
+	Path    string
+	Message string
+}
+
+func (e *AttributeError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%s: %s", ErrInvalidAttributes, e.Message)
+	}
+
+	return fmt.Sprintf("%s: %s %s", ErrInvalidAttributes, e.Path, e.Message)
+}
+
+func (e *AttributeError) Unwrap() error {
+	return ErrInvalidAttributes
+}
+
+// ParseAttributeSchema parses a JSON Schema document
+func ParseAttributeSchema(data []byte) (*AttributeSchema, error) {
+	var s AttributeSchema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// compile compiles the patterns of the schema once, it is safe for concurrent use
+func (s *AttributeSchema) compile() error {
+	s.once.Do(func() { s.err = s.compilePatterns() })
+	return s.err
+}
+
+func (s *AttributeSchema) compilePatterns() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+
+		s.pattern = re
+	}
+
+	for _, p := range s.Properties {
+		if err := p.compile(); err != nil {
+			return err
+		}
+	}
+
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+
+	return nil
+}
+
+// Validate checks the attributes against the schema.
+// Returns an *AttributeError which wraps ErrInvalidAttributes when they do not match.
+// It is safe for concurrent use.
+func (s *AttributeSchema) Validate(attrs Attributes) error {
+	if err := s.compile(); err != nil {
+		return err
+	}
+
+	// normalize go values to their json representation
+	data, err := json.Marshal(attrs)
+	if err != nil {
+		return err
+	}
+
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	return s.validate("", v)
+}
+
+// jsonEqual compares the json representation of enum value e with the json decoded value v,
+// so that "1" does not equal 1 and enums built from go values match decoded numbers
+func jsonEqual(e, v any) bool {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return false
+	}
+
+	var normalized any
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(normalized, v)
+}
+
+func (s *AttributeSchema) validate(path string, v any) error {
+	fail := func(format string, args ...any) error {
+		return &AttributeError{Path: path, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if s.Type != "" && !jsonTypeIs(s.Type, v) {
+		return fail("must be of type %s", s.Type)
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if jsonEqual(e, v) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fail("must be one of %v", s.Enum)
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(val)
+		if s.MinLength != nil && n < *s.MinLength {
+			return fail("must be at least %d characters", *s.MinLength)
+		}
+
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fail("must be at most %d characters", *s.MaxLength)
+		}
+
+		if s.pattern != nil && !s.pattern.MatchString(val) {
+			return fail("must match %s", s.Pattern)
+		}
+	case float64:
+		if s.Minimum != nil && val < *s.Minimum {
+			return fail("must be at least %v", *s.Minimum)
+		}
+
+		if s.Maximum != nil && val > *s.Maximum {
+			return fail("must be at most %v", *s.Maximum)
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range val {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]any:
+		for _, req := range s.Required {
+			if _, ok := val[req]; !ok {
+				return &AttributeError{Path: joinPath(path, req), Message: "is required"}
+			}
+		}
+
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			prop, ok := s.Properties[k]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return &AttributeError{Path: joinPath(path, k), Message: "is not allowed"}
+				}
+
+				continue
+			}
+
+			if err := prop.validate(joinPath(path, k), val[k]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func joinPath(path, key string) string {
+	return strings.TrimPrefix(path+"."+key, ".")
+}
+
+func jsonTypeIs(typ string, v any) bool {
+	switch typ {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == float64(int64(f))
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "null":
+		return v == nil
+	}
+
+	return false
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Attributes are custom profile fields of a user stored as jsonb
+type Attributes map[string]any
+
+// Value implements driver.Valuer
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return "{}", nil
+	}
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (a *Attributes) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*a = Attributes{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into attributes", src)
+	}
+
+	attrs := Attributes{}
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		return err
+	}
+
+	*a = attrs
+	return nil
+}
+
+// Set sets the attribute value. A nil value removes the attribute when merged with UpdateAttributes
+func (a *Attributes) Set(key string, v any) {
+	if *a == nil {
+		*a = Attributes{}
+	}
+
+	(*a)[key] = v
+}
+
+// Get returns the raw attribute value
+func (a Attributes) Get(key string) (any, bool) {
+	v, ok := a[key]
+	return v, ok
+}
+
+// String returns the attribute as a string
+func (a Attributes) String(key string) (string, bool) {
+	v, ok := a[key].(string)
+	return v, ok
+}
+
+// Float returns a numeric attribute as float64
+func (a Attributes) Float(key string) (float64, bool) {
+	switch v := a[key].(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+
+	return 0, false
+}
+
+// Int returns a numeric attribute as int64. Numbers with a fractional part are not converted.
+func (a Attributes) Int(key string) (int64, bool) {
+	switch v := a[key].(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+
+	f, ok := a.Float(key)
+	if !ok || f != float64(int64(f)) {
+		return 0, false
+	}
+
+	return int64(f), true
+}
+
+// Bool returns the attribute as a bool
+func (a Attributes) Bool(key string) (bool, bool) {
+	v, ok := a[key].(bool)
+	return v, ok
+}
+
+// Time returns an attribute stored as an RFC3339 string
+func (a Attributes) Time(key string) (time.Time, bool) {
+	switch v := a[key].(type) {
+	case time.Time:
+		return v, true
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		return t, err == nil
+	}
+
+	return time.Time{}, false
+}
+
+// Strings returns an attribute holding a list of strings
+func (a Attributes) Strings(key string) ([]string, bool) {
+	switch v := a[key].(type) {
+	case []string:
+		return v, true
+	case []any:
+		strs := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+
+			strs = append(strs, s)
+		}
+
+		return strs, true
+	}
+
+	return nil, false
+}
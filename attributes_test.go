@@ -0,0 +1,121 @@
+package auth_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/cristosal/auth"
+)
+
+func TestAttributesScan(t *testing.T) {
+	var attrs auth.Attributes
+	if err := attrs.Scan([]byte(`{"department":"sales","level":3,"remote":true,"tags":["a","b"]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := attrs.String("department"); v != "sales" {
+		t.Fatalf("expected sales got %s", v)
+	}
+
+	if v, ok := attrs.Int("level"); !ok || v != 3 {
+		t.Fatalf("expected 3 got %d", v)
+	}
+
+	if v, _ := attrs.Bool("remote"); !v {
+		t.Fatal("expected remote to be true")
+	}
+
+	if v, _ := attrs.Strings("tags"); len(v) != 2 || v[1] != "b" {
+		t.Fatalf("expected tags got %v", v)
+	}
+
+	if _, ok := attrs.String("level"); ok {
+		t.Fatal("expected level not to be a string")
+	}
+}
+
+func TestAttributeSchemaValidate(t *testing.T) {
+	schema, err := auth.ParseAttributeSchema([]byte(`{
+		"type": "object",
+		"required": ["department"],
+		"additionalProperties": false,
+		"properties": {
+			"department": {"type": "string", "enum": ["sales", "engineering"]},
+			"level": {"type": "integer", "minimum": 1, "maximum": 10},
+			"nickname": {"type": "string", "maxLength": 8, "pattern": "^[a-z]+$"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"code": {"enum": [1, true, "x"]}
+		}
+	}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		attrs auth.Attributes
+		path  string
+	}{
+		{auth.Attributes{"department": "sales", "level": 2, "tags": []string{"a"}}, ""},
+		{auth.Attributes{"level": 2}, "department"},
+		{auth.Attributes{"department": "hr"}, "department"},
+		{auth.Attributes{"department": "sales", "level": 2.5}, "level"},
+		{auth.Attributes{"department": "sales", "level": 11}, "level"},
+		{auth.Attributes{"department": "sales", "nickname": "Bob"}, "nickname"},
+		{auth.Attributes{"department": "sales", "nickname": "abcdefghi"}, "nickname"},
+		{auth.Attributes{"department": "sales", "tags": []any{"a", 1}}, "tags[1]"},
+		{auth.Attributes{"department": "sales", "other": true}, "other"},
+		{auth.Attributes{"department": "sales", "code": 1}, ""},
+		{auth.Attributes{"department": "sales", "code": true}, ""},
+		{auth.Attributes{"department": "sales", "code": "x"}, ""},
+		{auth.Attributes{"department": "sales", "code": "1"}, "code"},
+		{auth.Attributes{"department": "sales", "code": "true"}, "code"},
+		{auth.Attributes{"department": "sales", "code": 2}, "code"},
+	}
+
+	for _, tc := range tt {
+		err := schema.Validate(tc.attrs)
+		if tc.path == "" {
+			if err != nil {
+				t.Fatalf("expected %v to be valid got %v", tc.attrs, err)
+			}
+
+			continue
+		}
+
+		var attrErr *auth.AttributeError
+		if !errors.As(err, &attrErr) || !errors.Is(err, auth.ErrInvalidAttributes) {
+			t.Fatalf("expected attribute error for %v got %v", tc.attrs, err)
+		}
+
+		if attrErr.Path != tc.path {
+			t.Fatalf("expected path %s got %s", tc.path, attrErr.Path)
+		}
+	}
+}
+
+func TestAttributeSchemaConcurrentValidate(t *testing.T) {
+	schema := &auth.AttributeSchema{
+		Properties: map[string]*auth.AttributeSchema{
+			"code": {Type: "string", Pattern: "^[A-Z]{3}$"},
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := schema.Validate(auth.Attributes{"code": "ABC"}); err != nil {
+				t.Error(err)
+			}
+
+			if err := schema.Validate(auth.Attributes{"code": "abc"}); !errors.Is(err, auth.ErrInvalidAttributes) {
+				t.Errorf("expected invalid attributes got %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
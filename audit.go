@@ -0,0 +1,381 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+type AuditAction string
+
+const (
+	AuditLogin                  AuditAction = AuditAction(EventUserLogin)
+	AuditLoginFailed            AuditAction = "user.login_failed"
+	AuditLogout                 AuditAction = "user.logout"
+	AuditPasswordResetRequested AuditAction = "user.password_reset_requested"
+	AuditPasswordReset          AuditAction = AuditAction(EventPasswordReset)
+	AuditUserStatusChanged      AuditAction = AuditAction(EventUserStatusChanged)
+	AuditUserErased             AuditAction = AuditAction(EventUserErased)
+	AuditUsersImported          AuditAction = "user.imported"
+	AuditUsersExported          AuditAction = "user.exported"
+	AuditUserInvited            AuditAction = AuditAction(EventUserInvited)
+	AuditInvitationRevoked      AuditAction = "invitation.revoked"
+	AuditInvitationAccepted     AuditAction = "invitation.accepted"
+	AuditImpersonationStarted   AuditAction = "user.impersonation_started"
+	AuditImpersonationStopped   AuditAction = "user.impersonation_stopped"
+	AuditGroupUserAdded         AuditAction = AuditAction(EventGroupUserAdded)
+	AuditGroupUserRemoved       AuditAction = AuditAction(EventGroupUserRemoved)
+	AuditGroupPermissionAdded   AuditAction = AuditAction(EventGroupPermissionAdded)
+	AuditGroupPermissionRemoved AuditAction = AuditAction(EventGroupPermissionRemoved)
+	AuditGroupParentChanged     AuditAction = AuditAction(EventGroupParentChanged)
+	AuditUserPermissionSet      AuditAction = AuditAction(EventUserPermissionSet)
+	AuditUserPermissionRemoved  AuditAction = AuditAction(EventUserPermissionRemoved)
+	AuditACLGranted             AuditAction = "acl.granted"
+	AuditACLRevoked             AuditAction = "acl.revoked"
+	AuditPolicyAdded            AuditAction = "policy.added"
+	AuditPolicyUpdated          AuditAction = "policy.updated"
+	AuditPolicyRemoved          AuditAction = "policy.removed"
+	AuditEntriesRedacted        AuditAction = "audit.redacted"
+)
+
+// auditLockKey is the advisory lock serializing writes to the hash chain
+const auditLockKey = 7305598117
+
+// AuditEntry is a record of a security relevant action
+type AuditEntry struct {
+	ID         int64
+	ActorID    *int64 // user performing the action, nil when anonymous or unknown
+	TargetID   *int64 // user affected by the action
+	Action     AuditAction
+	IP         string
+	UserAgent  string
+	Metadata   json.RawMessage
+	PrevHash   string
+	Hash       string
+	CreatedAt  time.Time
+	RedactedAt *time.Time // personal data was erased, the redacted contents are hashed in an audit.redacted entry
+}
+
+func (AuditEntry) TableName() string {
+	return "audit_log"
+}
+
+// NewAuditEntry returns an entry attributed to the session user, capturing the ip and user agent.
+// Entries of impersonated sessions are attributed to the impersonator and record the impersonated user
+// as impersonated_user_id in the metadata. The session can be nil.
+func NewAuditEntry(sess *Session, action AuditAction, targetID *int64, meta any) *AuditEntry {
+	e := &AuditEntry{Action: action, TargetID: targetID}
+
+	if meta != nil {
+		e.Metadata, _ = json.Marshal(meta)
+	}
+
+	if sess == nil {
+		return e
+	}
+
+	e.ActorID = sess.UserID()
+	e.IP = sess.IP
+	e.UserAgent = sess.UserAgent
+
+	if sess.IsImpersonated() {
+		m := make(map[string]any)
+		json.Unmarshal(e.Metadata, &m)
+		m["impersonated_user_id"] = e.ActorID
+		e.Metadata, _ = json.Marshal(m)
+		e.ActorID = &sess.Impersonator.ID
+	}
+
+	return e
+}
+
+// hashInput is the canonical representation of an entry used for hashing
+type hashInput struct {
+	PrevHash  string          `json:"prev_hash"`
+	ActorID   *int64          `json:"actor_id"`
+	TargetID  *int64          `json:"target_id"`
+	Action    string          `json:"action"`
+	IP        string          `json:"ip"`
+	UserAgent string          `json:"user_agent"`
+	Metadata  json.RawMessage `json:"metadata"`
+	CreatedAt string          `json:"created_at"`
+}
+
+// ComputeHash returns the hash of the entry contents chained to PrevHash
+func (e *AuditEntry) ComputeHash() string {
+	data, _ := json.Marshal(&hashInput{
+		PrevHash:  e.PrevHash,
+		ActorID:   e.ActorID,
+		TargetID:  e.TargetID,
+		Action:    string(e.Action),
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		Metadata:  canonicalJSON(e.Metadata),
+		CreatedAt: e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalJSON re-encodes json so that it hashes the same regardless of how postgres stores it
+func canonicalJSON(data json.RawMessage) json.RawMessage {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return json.RawMessage("{}")
+	}
+
+	out, _ := json.Marshal(v)
+	return out
+}
+
+// add writes an audit entry using the given transaction.
+// Entries are chained when the hash chain is enabled, a nil repo writes unchained entries.
+func (r *AuditRepo) add(tx orm.QuerierExecuter, e *AuditEntry) error {
+	return r.write(tx, e, r != nil && r.hashChain.Load())
+}
+
+func (r *AuditRepo) write(tx orm.QuerierExecuter, e *AuditEntry, chain bool) error {
+	if len(e.Metadata) == 0 {
+		e.Metadata = json.RawMessage("{}")
+	}
+
+	// postgres stores microsecond precision
+	e.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	e.PrevHash = ""
+	e.Hash = ""
+
+	if chain {
+		if err := orm.Exec(tx, "select pg_advisory_xact_lock($1)", auditLockKey); err != nil {
+			return err
+		}
+
+		row := tx.QueryRow("select hash from audit_log where hash <> '' order by id desc limit 1")
+		if err := row.Scan(&e.PrevHash); err != nil && !errors.Is(err, orm.ErrNotFound) {
+			return err
+		}
+
+		e.Hash = e.ComputeHash()
+	}
+
+	return orm.Add(tx, e)
+}
+
+// redactUsers erases the ip, user agent, metadata and references to the users from their audit entries.
+// Entries already redacted for another user have the remaining references removed.
+// Every matching entry changes, the hashes of the redacted contents of chained entries are recorded
+// in a chained audit.redacted entry so that Verify can keep checking them.
+func (r *AuditRepo) redactUsers(tx orm.QuerierExecuter, uids []int64) error {
+	var entries []AuditEntry
+	err := orm.Query(tx, &entries, `update audit_log set ip = '', user_agent = '', metadata = '{}', redacted_at = coalesce(redacted_at, now()),
+			actor_id = case when actor_id = any($1) then null else actor_id end,
+			target_id = case when target_id = any($1) then null else target_id end
+		where actor_id = any($1) or target_id = any($1)
+		returning `+orm.Columns(&AuditEntry{}).List(), uids)
+
+	if err != nil {
+		return err
+	}
+
+	hashes := make(map[string]string)
+	for i := range entries {
+		if e := &entries[i]; e.Hash != "" {
+			hashes[strconv.FormatInt(e.ID, 10)] = e.ComputeHash()
+		}
+	}
+
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	return r.write(tx, NewAuditEntry(nil, AuditEntriesRedacted, nil, map[string]any{"entries": hashes}), true)
+}
+
+// AuditFilter narrows audit log queries. Empty fields are ignored
+type AuditFilter struct {
+	UserID *int64 // matches entries where the user is the actor or the target
+	Action AuditAction
+	From   *time.Time
+	To     *time.Time
+}
+
+func (f *AuditFilter) where() (string, []any) {
+	if f == nil {
+		return "", nil
+	}
+
+	var (
+		parts []string
+		args  []any
+	)
+
+	if f.UserID != nil {
+		args = append(args, *f.UserID)
+		parts = append(parts, fmt.Sprintf("(actor_id = $%d or target_id = $%d)", len(args), len(args)))
+	}
+
+	if f.Action != "" {
+		args = append(args, f.Action)
+		parts = append(parts, fmt.Sprintf("action = $%d", len(args)))
+	}
+
+	if f.From != nil {
+		args = append(args, *f.From)
+		parts = append(parts, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+
+	if f.To != nil {
+		args = append(args, *f.To)
+		parts = append(parts, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+
+	if len(parts) == 0 {
+		return "", nil
+	}
+
+	return "where " + strings.Join(parts, " and "), args
+}
+
+// AuditRepo provides access to the audit log
+type AuditRepo struct {
+	db        orm.DB
+	hashChain atomic.Bool
+}
+
+func NewAuditRepo(db orm.DB) *AuditRepo {
+	return &AuditRepo{db: db}
+}
+
+// UseHashChain enables tamper evidence for the audit log.
+// When enabled each entry stores a hash of its contents chained to the hash of the previous entry.
+// All processes writing to the audit log should enable it.
+func (r *AuditRepo) UseHashChain(enabled bool) {
+	r.hashChain.Store(enabled)
+}
+
+// Add writes an entry to the audit log
+func (r *AuditRepo) Add(e *AuditEntry) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := r.add(tx, e); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Paginate returns the most recent entries matching the filter
+func (r *AuditRepo) Paginate(page int, f *AuditFilter) ([]AuditEntry, *orm.PaginationResults, error) {
+	var (
+		entries    []AuditEntry
+		where, arg = f.where()
+	)
+
+	results, err := paginate(r.db, &entries, where, arg, page, PageSize, "id desc")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entries, results, nil
+}
+
+// Verify checks the hash chain of the audit log.
+// Returns ErrAuditTampered along with the id of the first entry which does not match its hash.
+// Redacted entries keep their place in the chain and their contents are checked
+// against the hash recorded by the last audit.redacted entry which redacted them.
+func (r *AuditRepo) Verify() (int64, error) {
+	var (
+		lastID   int64
+		prevHash string
+		redacted = make(map[int64]string) // current hashes of redacted entries
+		recorded = make(map[int64]string) // hashes recorded by the last redaction of each entry
+	)
+
+	for {
+		var entries []AuditEntry
+		if err := orm.List(r.db, &entries, "where id > $1 and hash <> '' order by id asc limit 1000", lastID); err != nil {
+			return 0, err
+		}
+
+		if len(entries) == 0 {
+			break
+		}
+
+		for i := range entries {
+			e := &entries[i]
+			if e.PrevHash != prevHash {
+				return e.ID, ErrAuditTampered
+			}
+
+			if e.RedactedAt != nil {
+				redacted[e.ID] = e.ComputeHash()
+			} else if e.ComputeHash() != e.Hash {
+				return e.ID, ErrAuditTampered
+			}
+
+			if e.Action == AuditEntriesRedacted {
+				if id, ok := readRedactions(e, redacted, recorded); !ok {
+					return id, ErrAuditTampered
+				}
+			}
+
+			prevHash = e.Hash
+			lastID = e.ID
+		}
+	}
+
+	// redacted entries without a matching redaction record
+	var first int64
+	for id, hash := range redacted {
+		if recorded[id] != hash && (first == 0 || id < first) {
+			first = id
+		}
+	}
+
+	if first != 0 {
+		return first, ErrAuditTampered
+	}
+
+	return 0, nil
+}
+
+// readRedactions records the hashes of the entries redacted by the redaction entry.
+// Entries can be redacted again when another user they reference is erased, the last record applies.
+// Returns the id of an entry which was not redacted before the redaction entry.
+func readRedactions(e *AuditEntry, redacted, recorded map[int64]string) (int64, bool) {
+	var meta struct {
+		Entries map[string]string `json:"entries"`
+	}
+
+	if err := json.Unmarshal(e.Metadata, &meta); err != nil {
+		return e.ID, false
+	}
+
+	for key, hash := range meta.Entries {
+		id, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return e.ID, false
+		}
+
+		if _, ok := redacted[id]; !ok {
+			return id, false
+		}
+
+		recorded[id] = hash
+	}
+
+	return 0, true
+}
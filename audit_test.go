@@ -0,0 +1,168 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cristosal/auth"
+)
+
+func TestAuditEntryHash(t *testing.T) {
+	uid := int64(1)
+	e := auth.AuditEntry{
+		ActorID:   &uid,
+		TargetID:  &uid,
+		Action:    auth.AuditLogin,
+		IP:        "127.0.0.1",
+		Metadata:  json.RawMessage(`{"b": 1, "a": "x"}`),
+		CreatedAt: time.Date(2023, 11, 20, 10, 0, 0, 0, time.UTC),
+	}
+
+	h := e.ComputeHash()
+
+	// postgres may store jsonb with different key order and spacing
+	e.Metadata = json.RawMessage(`{"a":"x","b":1}`)
+	if e.ComputeHash() != h {
+		t.Fatal("expected hash to be independent of json formatting")
+	}
+
+	e.IP = "10.0.0.1"
+	if e.ComputeHash() == h {
+		t.Fatal("expected hash to change when contents change")
+	}
+
+	e.IP = "127.0.0.1"
+	e.PrevHash = h
+	if e.ComputeHash() == h {
+		t.Fatal("expected hash to be chained to previous hash")
+	}
+}
+
+func TestAuditFilterWhere(t *testing.T) {
+	var (
+		uid  = int64(3)
+		from = time.Now()
+		f    = auth.AuditFilter{UserID: &uid, Action: auth.AuditLoginFailed, From: &from}
+	)
+
+	where, args := f.Where()
+	expected := "where (actor_id = $1 or target_id = $1) and action = $2 and created_at >= $3"
+	if where != expected {
+		t.Fatalf("expected %q got %q", expected, where)
+	}
+
+	if len(args) != 3 {
+		t.Fatalf("expected 3 args got %d", len(args))
+	}
+
+	var empty *auth.AuditFilter
+	if where, _ := empty.Where(); where != "" {
+		t.Fatal("expected nil filter to be empty")
+	}
+}
+
+func TestAuditEntryImpersonated(t *testing.T) {
+	sess := &auth.Session{
+		IP:           "127.0.0.1",
+		User:         &auth.User{ID: 2},
+		Impersonator: &auth.User{ID: 1},
+	}
+
+	e := auth.NewAuditEntry(sess, auth.AuditLogout, nil, map[string]any{"reason": "test"})
+	if e.ActorID == nil || *e.ActorID != 1 {
+		t.Fatalf("expected impersonator to be the actor got %v", e.ActorID)
+	}
+
+	var meta map[string]any
+	if err := json.Unmarshal(e.Metadata, &meta); err != nil {
+		t.Fatal(err)
+	}
+
+	if meta["impersonated_user_id"] != float64(2) || meta["reason"] != "test" {
+		t.Fatalf("unexpected metadata %v", meta)
+	}
+}
+
+func TestAuditVerifyAfterErase(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	svc.Audit().UseHashChain(true)
+
+	res, err := svc.Users().Register(&auth.RegistrationRequest{Name: "Audit User", Email: "audit-erase@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, action := range []auth.AuditAction{auth.AuditLogin, auth.AuditLogout} {
+		e := auth.AuditEntry{TargetID: &res.UserID, Action: action, IP: "127.0.0.1", Metadata: json.RawMessage(`{"email": "audit-erase@example.com"}`)}
+		if err := svc.Audit().Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := svc.EraseUser(res.UserID); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _, err := svc.Audit().Paginate(0, &auth.AuditFilter{Action: auth.AuditEntriesRedacted})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) == 0 || entries[0].Hash == "" {
+		t.Fatal("expected a chained redaction entry")
+	}
+
+	if id, err := svc.Audit().Verify(); err != nil {
+		t.Fatalf("expected chain to verify after erasure got %v at %d", err, id)
+	}
+}
+
+func TestAuditVerifyAfterEraseBoth(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	svc.Audit().UseHashChain(true)
+
+	var uids []int64
+	for _, email := range []string{"audit-actor@example.com", "audit-target@example.com"} {
+		res, err := svc.Users().Register(&auth.RegistrationRequest{Name: "Audit User", Email: email, Password: "password123"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		uids = append(uids, res.UserID)
+	}
+
+	e := auth.AuditEntry{ActorID: &uids[0], TargetID: &uids[1], Action: auth.AuditLogin, IP: "127.0.0.1"}
+	if err := svc.Audit().Add(&e); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, uid := range uids {
+		if err := svc.EraseUser(uid); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, _, err := svc.Audit().Paginate(0, &auth.AuditFilter{Action: auth.AuditLogin})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if entry.ID == e.ID && (entry.ActorID != nil || entry.TargetID != nil) {
+			t.Fatalf("expected both references to be removed got actor %v target %v", entry.ActorID, entry.TargetID)
+		}
+	}
+
+	if id, err := svc.Audit().Verify(); err != nil {
+		t.Fatalf("expected chain to verify after both erasures got %v at %d", err, id)
+	}
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+)
+
+var (
+	DeviceCookieName     = "auth_device"
+	DeviceCookieDuration = time.Hour * 24 * 365 * 2
+)
+
+// DeviceID returns the device fingerprint stored in the device cookie.
+// A new random id is generated and set on the response when the cookie is missing.
+// Store it in Session.DeviceID so logins can be tracked per device.
+func DeviceID(w http.ResponseWriter, r *http.Request) (string, error) {
+	if c, err := r.Cookie(DeviceCookieName); err == nil && len(c.Value) == 32 {
+		return c.Value, nil
+	}
+
+	id, err := GenerateToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     DeviceCookieName,
+		Value:    id,
+		Path:     "/",
+		Expires:  time.Now().Add(DeviceCookieDuration),
+		MaxAge:   int(DeviceCookieDuration.Seconds()),
+		HttpOnly: true,
+		Secure:   SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return id, nil
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// EmailCanonicalizer returns the canonical local part of an address for a mail provider
+type EmailCanonicalizer func(local string) string
+
+var (
+	// RejectCanonicalDuplicates refuses registrations whose canonical email matches an existing user,
+	// for example j.doe+news@gmail.com when jdoe@gmail.com is registered
+	RejectCanonicalDuplicates = false
+
+	// EmailCanonicalizers maps provider domains to the rules used by CanonicalEmail
+	EmailCanonicalizers = map[string]EmailCanonicalizer{
+		"gmail.com":      gmailCanonical,
+		"googlemail.com": gmailCanonical,
+		"outlook.com":    stripPlus,
+		"hotmail.com":    stripPlus,
+		"live.com":       stripPlus,
+		"icloud.com":     stripPlus,
+		"me.com":         stripPlus,
+		"fastmail.com":   stripPlus,
+		"proton.me":      stripPlus,
+		"protonmail.com": stripPlus,
+	}
+
+	// EmailDomainAliases maps provider domains to the domain used in canonical addresses
+	EmailDomainAliases = map[string]string{
+		"googlemail.com": "gmail.com",
+		"protonmail.com": "proton.me",
+	}
+)
+
+var emailProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+)
+
+// NormalizeEmail trims and lowercases the address and converts internationalized
+// domains to their ascii (punycode) form. Returns ErrInvalidEmail when the address is malformed.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+
+	at := strings.LastIndex(email, "@")
+	if at < 1 || at == len(email)-1 {
+		return "", ErrInvalidEmail
+	}
+
+	local, domain := email[:at], email[at+1:]
+	if !utf8.ValidString(local) || len(local) > 64 || strings.ContainsAny(local, " \t\r\n\"<>,;") {
+		return "", ErrInvalidEmail
+	}
+
+	domain, err := emailProfile.ToASCII(strings.TrimSuffix(domain, "."))
+	if err != nil || !strings.Contains(domain, ".") {
+		return "", ErrInvalidEmail
+	}
+
+	email = strings.ToLower(local) + "@" + domain
+	if len(email) > 254 {
+		return "", ErrInvalidEmail
+	}
+
+	return email, nil
+}
+
+// CanonicalEmail returns the address with provider specific variations removed,
+// such as dots and plus suffixes for gmail. It is used to detect duplicate accounts
+// and is never used to send mail. Invalid addresses are returned lowercased.
+func CanonicalEmail(email string) string {
+	normalized, err := NormalizeEmail(email)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(email))
+	}
+
+	at := strings.LastIndex(normalized, "@")
+	local, domain := normalized[:at], normalized[at+1:]
+
+	if fn, ok := EmailCanonicalizers[domain]; ok {
+		local = fn(local)
+	}
+
+	if alias, ok := EmailDomainAliases[domain]; ok {
+		domain = alias
+	}
+
+	return local + "@" + domain
+}
+
+func stripPlus(local string) string {
+	if i := strings.Index(local, "+"); i > 0 {
+		return local[:i]
+	}
+
+	return local
+}
+
+func gmailCanonical(local string) string {
+	return strings.ReplaceAll(stripPlus(local), ".", "")
+}
@@ -0,0 +1,56 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cristosal/auth"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tt := []struct {
+		input    string
+		expected string
+		err      error
+	}{
+		{" John.Doe@Example.COM ", "john.doe@example.com", nil},
+		{"user@bücher.de", "user@xn--bcher-kva.de", nil},
+		{"user@BÜCHER.de", "user@xn--bcher-kva.de", nil},
+		{"user@example.com.", "user@example.com", nil},
+		{"user", "", auth.ErrInvalidEmail},
+		{"@example.com", "", auth.ErrInvalidEmail},
+		{"user@", "", auth.ErrInvalidEmail},
+		{"user@localhost", "", auth.ErrInvalidEmail},
+		{"john doe@example.com", "", auth.ErrInvalidEmail},
+	}
+
+	for _, tc := range tt {
+		got, err := auth.NormalizeEmail(tc.input)
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("%q: expected error %v got %v", tc.input, tc.err, err)
+		}
+
+		if got != tc.expected {
+			t.Fatalf("%q: expected %q got %q", tc.input, tc.expected, got)
+		}
+	}
+}
+
+func TestCanonicalEmail(t *testing.T) {
+	tt := []struct {
+		input    string
+		expected string
+	}{
+		{"J.Doe+news@Gmail.com", "jdoe@gmail.com"},
+		{"jdoe@googlemail.com", "jdoe@gmail.com"},
+		{"jdoe+work@outlook.com", "jdoe@outlook.com"},
+		{"j.doe+work@example.com", "j.doe+work@example.com"},
+		{"user@bücher.de", "user@xn--bcher-kva.de"},
+	}
+
+	for _, tc := range tt {
+		if got := auth.CanonicalEmail(tc.input); got != tc.expected {
+			t.Fatalf("%q: expected %q got %q", tc.input, tc.expected, got)
+		}
+	}
+}
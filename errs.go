@@ -4,17 +4,52 @@ import "errors"
 
 // package wide errors go here
 var (
+	ErrAuditTampered      = errors.New("audit log tampered")
+	ErrForbidden          = errors.New("forbidden")
+	ErrGroupCycle         = errors.New("group cycle")
 	ErrGroupNotFound      = errors.New("group not found")
 	ErrEmailRequired      = errors.New("email is required")
+	ErrInvalidAttributes  = errors.New("invalid attributes")
+	ErrInvalidCode        = errors.New("invalid code")
+	ErrInvalidCursor      = errors.New("invalid cursor")
+	ErrInvalidEmail       = errors.New("invalid email")
+	ErrInvalidPhone       = errors.New("invalid phone number")
+	ErrInvalidPolicy      = errors.New("invalid policy")
+	ErrInvalidQuantity    = errors.New("invalid quantity")
+	ErrNotQuantity        = errors.New("permission is not a quantity")
+	ErrInvalidQuery       = errors.New("invalid query")
+	ErrInvalidSignature   = errors.New("invalid signature")
 	ErrInvalidToken       = errors.New("invalid token")
+	ErrInvalidTuple       = errors.New("invalid tuple")
+	ErrInvalidUsername    = errors.New("invalid username")
+	ErrInvitationExpired  = errors.New("invitation expired")
+	ErrInvitationNotFound = errors.New("invitation not found")
 	ErrNameRequired       = errors.New("name is required")
+	ErrNoSMSSender        = errors.New("no sms sender configured")
+	ErrNotImpersonating   = errors.New("session is not impersonated")
 	ErrPasswordRequired   = errors.New("password is required")
 	ErrPermissionNotFound = errors.New("permission not found")
+	ErrPhoneNotConfirmed  = errors.New("phone not confirmed")
+	ErrPhoneRequired      = errors.New("phone is required")
+	ErrPolicyEvaluation   = errors.New("policy evaluation failed")
+	ErrPolicyNotFound     = errors.New("policy not found")
+	ErrQuotaExceeded      = errors.New("quota exceeded")
 	ErrSessionNotFound    = errors.New("session not found")
 	ErrSessionExpired     = errors.New("session expired")
+	ErrSignatureExpired   = errors.New("signature expired")
 	ErrTokenExpired       = errors.New("token expired")
 	ErrTokenNotFound      = errors.New("token not found")
 	ErrUnauthorized       = errors.New("unauthorized")
+	ErrUnsupportedFormat  = errors.New("unsupported format")
+	ErrUnsupportedHash    = errors.New("unsupported password hash")
+	ErrURLRequired        = errors.New("url is required")
+	ErrUserDeleted        = errors.New("user deleted")
+	ErrUserDisabled       = errors.New("user disabled")
+	ErrAccountLocked      = errors.New("account locked")
 	ErrUserExists         = errors.New("user exists")
 	ErrUserNotFound       = errors.New("user not found")
+	ErrUserSuspended      = errors.New("user suspended")
+	ErrUsernameReserved   = errors.New("username reserved")
+	ErrUsernameTaken      = errors.New("username taken")
+	ErrWebhookNotFound    = errors.New("webhook not found")
 )
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+type EventType string
+
+const (
+	EventUserRegistered         EventType = "user.registered"
+	EventUserConfirmed          EventType = "user.confirmed"
+	EventUserLogin              EventType = "user.login"
+	EventNewDevice              EventType = "user.new_device"
+	EventImpossibleTravel       EventType = "user.impossible_travel"
+	EventUserStatusChanged      EventType = "user.status_changed"
+	EventUserErased             EventType = "user.erased"
+	EventUserInvited            EventType = "user.invited"
+	EventPasswordReset          EventType = "user.password_reset"
+	EventGroupUserAdded         EventType = "group.user_added"
+	EventGroupUserRemoved       EventType = "group.user_removed"
+	EventGroupPermissionAdded   EventType = "group.permission_added"
+	EventGroupPermissionRemoved EventType = "group.permission_removed"
+	EventGroupParentChanged     EventType = "group.parent_changed"
+	EventUserPermissionSet      EventType = "user.permission_set"
+	EventUserPermissionRemoved  EventType = "user.permission_removed"
+)
+
+// Event is an entry in the auth_events outbox.
+// Events are written in the same transaction as the change they describe.
+type Event struct {
+	ID            int64
+	Type          EventType
+	UserID        *int64
+	Payload       json.RawMessage
+	Attempts      int
+	LastError     string
+	CreatedAt     time.Time
+	NextAttemptAt time.Time
+	DeliveredAt   *time.Time
+}
+
+func (Event) TableName() string {
+	return "auth_events"
+}
+
+// IsDelivered is true when the event has been sent to the sink
+func (e *Event) IsDelivered() bool {
+	return e.DeliveredAt != nil
+}
+
+// addEvent writes an event to the outbox using the given transaction
+func addEvent(tx orm.Executer, typ EventType, uid *int64, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return orm.Exec(tx, "insert into auth_events (type, user_id, payload) values ($1, $2, $3)", typ, uid, data)
+}
+
+// EventRepo provides access to the auth_events outbox
+type EventRepo struct{ db orm.DB }
+
+func NewEventRepo(db orm.DB) *EventRepo {
+	return &EventRepo{db}
+}
+
+// Undelivered returns events that have not yet been delivered, oldest first
+func (r *EventRepo) Undelivered(limit int) ([]Event, error) {
+	var events []Event
+	if err := orm.List(r.db, &events, "where delivered_at is null order by id asc limit $1", limit); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Retry schedules an undelivered event for immediate delivery, resetting its attempts
+func (r *EventRepo) Retry(id int64) error {
+	return orm.Exec(r.db, "update auth_events set attempts = 0, next_attempt_at = now() where id = $1 and delivered_at is null", id)
+}
+
+// RemoveDelivered deletes events delivered before t
+func (r *EventRepo) RemoveDelivered(t time.Time) error {
+	return orm.Exec(r.db, "delete from auth_events where delivered_at < $1", t)
+}
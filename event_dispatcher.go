@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+const (
+	EventBatchSize   = 100
+	EventMaxAttempts = 10
+	EventLease       = time.Minute * 5
+)
+
+// EventSink is the interface implemented by downstream event consumers
+type EventSink interface {
+	Send(ctx context.Context, e *Event) error
+}
+
+// EventSinkFunc allows using ordinary functions as an EventSink
+type EventSinkFunc func(ctx context.Context, e *Event) error
+
+// Send is the implementation of the EventSink interface
+func (f EventSinkFunc) Send(ctx context.Context, e *Event) error {
+	return f(ctx, e)
+}
+
+// ExponentialBackoff returns a backoff func doubling base for every attempt, capped at max
+func ExponentialBackoff(base, max time.Duration) func(attempts int) time.Duration {
+	return func(attempts int) time.Duration {
+		d := base
+		for i := 1; i < attempts && d < max; i++ {
+			d *= 2
+		}
+
+		if d > max {
+			return max
+		}
+
+		return d
+	}
+}
+
+// EventDispatcher delivers outbox events to an EventSink.
+// Multiple dispatchers can run concurrently as claimed events are leased and skipped by other dispatchers.
+type EventDispatcher struct {
+	db          orm.DB
+	sink        EventSink
+	BatchSize   int
+	MaxAttempts int                              // events are no longer retried after MaxAttempts failures
+	Backoff     func(attempts int) time.Duration // delay before the next attempt
+	Lease       time.Duration                    // claimed events are retried after the lease if the dispatcher dies mid batch
+	OnError     func(err error)                  // called by Run when dispatching fails, nil ignores errors
+}
+
+// NewEventDispatcher returns a dispatcher with default batch size, attempts and backoff
+func NewEventDispatcher(db orm.DB, sink EventSink) *EventDispatcher {
+	return &EventDispatcher{
+		db:          db,
+		sink:        sink,
+		BatchSize:   EventBatchSize,
+		MaxAttempts: EventMaxAttempts,
+		Backoff:     ExponentialBackoff(time.Second, time.Hour),
+		Lease:       EventLease,
+	}
+}
+
+// Dispatch claims a batch of due events and sends them to the sink.
+// Events are claimed by pushing their next attempt past the lease, no transaction is held while sending.
+// Failed events are rescheduled according to Backoff.
+// Returns the number of events delivered.
+func (d *EventDispatcher) Dispatch(ctx context.Context) (int, error) {
+	var events []Event
+	cols := orm.Columns(&Event{}).List()
+	err := orm.Query(d.db, &events, `update auth_events set next_attempt_at = $1 where id in (
+			select id from auth_events where delivered_at is null and next_attempt_at <= now() and attempts < $2
+			order by id asc limit $3 for update skip locked
+		) returning `+cols, time.Now().Add(d.Lease), d.MaxAttempts, d.BatchSize)
+
+	if err != nil {
+		return 0, err
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+
+	delivered := 0
+	for i := range events {
+		e := &events[i]
+		if err := d.sink.Send(ctx, e); err != nil {
+			next := time.Now().Add(d.Backoff(e.Attempts + 1))
+			err = orm.Exec(d.db, "update auth_events set attempts = attempts + 1, last_error = $1, next_attempt_at = $2 where id = $3",
+				err.Error(), next, e.ID)
+
+			if err != nil {
+				return delivered, err
+			}
+
+			continue
+		}
+
+		if err := orm.Exec(d.db, "update auth_events set delivered_at = now() where id = $1", e.ID); err != nil {
+			return delivered, err
+		}
+
+		delivered++
+	}
+
+	return delivered, nil
+}
+
+// Run dispatches events every interval until the context is cancelled.
+// Batches are dispatched back to back while there are due events.
+// Errors such as a lost database connection are reported to OnError and retried according to Backoff.
+func (d *EventDispatcher) Run(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	failures := 0
+	for {
+		n, err := d.Dispatch(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			failures++
+			if d.OnError != nil {
+				d.OnError(err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(d.Backoff(failures)):
+			}
+
+			continue
+		}
+
+		failures = 0
+		if n == d.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
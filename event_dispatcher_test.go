@@ -0,0 +1,70 @@
+package auth_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cristosal/auth"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := auth.ExponentialBackoff(time.Second, time.Minute)
+
+	tt := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, time.Second * 2},
+		{4, time.Second * 8},
+		{7, time.Minute},
+		{100, time.Minute},
+	}
+
+	for _, tc := range tt {
+		if d := backoff(tc.attempts); d != tc.expected {
+			t.Fatalf("expected %s for %d attempts got %s", tc.expected, tc.attempts, d)
+		}
+	}
+}
+
+var errDown = errors.New("database is down")
+
+// downDB fails every statement
+type downDB struct{}
+
+func (downDB) Begin() (*sql.Tx, error)                 { return nil, errDown }
+func (downDB) Exec(string, ...any) (sql.Result, error) { return nil, errDown }
+func (downDB) Query(string, ...any) (*sql.Rows, error) { return nil, errDown }
+func (downDB) QueryRow(string, ...any) *sql.Row        { return nil }
+
+func TestEventDispatcherRunContinuesOnError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sink := auth.EventSinkFunc(func(ctx context.Context, e *auth.Event) error { return nil })
+	d := auth.NewEventDispatcher(downDB{}, sink)
+	d.Backoff = func(attempts int) time.Duration { return time.Millisecond }
+
+	failures := 0
+	d.OnError = func(err error) {
+		if !errors.Is(err, errDown) {
+			t.Errorf("expected database error got %v", err)
+		}
+
+		if failures++; failures == 3 {
+			cancel()
+		}
+	}
+
+	if err := d.Run(ctx, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected run to stop on cancellation got %v", err)
+	}
+
+	if failures != 3 {
+		t.Fatalf("expected 3 reported failures got %d", failures)
+	}
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+
+	"github.com/cristosal/orm"
+)
+
+// PostWebhook exposes the signed post of the webhook dispatcher to tests
+func (d *WebhookDispatcher) PostWebhook(ctx context.Context, url, secret string, typ EventType, payload []byte) (int, error) {
+	j := webhookJob{URL: url, Secret: secret}
+	j.EventType = typ
+	j.Payload = payload
+	return d.post(ctx, &j)
+}
+
+// RunBeforeRegister runs the before register hooks outside of a transaction
+func (h *Hooks) RunBeforeRegister(req *RegistrationRequest) error {
+	return h.beforeRegister.run(nil, req)
+}
+
+// RunBeforeAddUser runs the before add user hooks outside of a transaction
+func (h *Hooks) RunBeforeAddUser(m *GroupMembership) error {
+	return h.beforeAddUser.run(nil, m)
+}
+
+// RunNilHooks runs a nil hook list
+func RunNilHooks(tx orm.QuerierExecuter) error {
+	var l *hookList[*User]
+	return l.run(tx, nil)
+}
+
+// Where exposes the where clause of the filter to tests
+func (f *AuditFilter) Where() (string, []any) {
+	return f.where()
+}
+
+// Build exposes the sql built for the query to tests
+func (q *UserQuery) Build() (string, []any, error) {
+	return q.build()
+}
+
+// CursorFor exposes the cursor positioned after u to tests
+func (q *UserQuery) CursorFor(u *User) string {
+	return q.cursor(u)
+}
+
+// NewUserRecord exposes the export record of a user to tests
+func NewUserRecord(u *User, groups []string, includeHash bool) *UserRecord {
+	return newUserRecord(u, groups, includeHash)
+}
+
+// WriteCSVRecord writes the csv header and the row of the record as Export does
+func WriteCSVRecord(w io.Writer, rec *UserRecord, includeHash bool) {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader(includeHash))
+	cw.Write(rec.csvRow(includeHash))
+	cw.Flush()
+}
+
+// NewRecordReader exposes the import record reader to tests
+func NewRecordReader(rd io.Reader, format UserFormat) (func() (int, *UserRecord, error), error) {
+	return newRecordReader(rd, format)
+}
+
+// Resolve exposes the resolution of group entries by UserPermissions to tests
+func (gps GroupPermissions) Resolve(strategy PermissionStrategy) GroupPermissions {
+	return gps.resolve(strategy)
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+// UserExport is an archive of everything stored about a user
+type UserExport struct {
+	ExportedAt    time.Time        `json:"exported_at"`
+	User          *User            `json:"user"`
+	Groups        Groups           `json:"groups"`
+	Permissions   []UserPermission `json:"permissions"`
+	ACLEntries    []ACLEntry       `json:"acl_entries"`
+	Relations     []Tuple          `json:"relations"`
+	QuotaUsage    []QuotaRecord    `json:"quota_usage"`
+	Invitations   []Invitation     `json:"invitations"`
+	Sessions      []Session        `json:"sessions"`
+	Tokens        []ExportedToken  `json:"tokens"`
+	Devices       []Device         `json:"devices"`
+	LoginAttempts []LoginAttempt   `json:"login_attempts"`
+	AuditEntries  []AuditEntry     `json:"audit_entries"`
+	Events        []Event          `json:"events"`
+}
+
+// ExportedToken describes a pending token without revealing its value
+type ExportedToken struct {
+	Type    string    `json:"type"`
+	Email   string    `json:"email,omitempty"`
+	Phone   string    `json:"phone,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// ExportUser returns everything the package stores about a user.
+// Marshal the result with encoding/json for a machine readable archive.
+func (s *Service) ExportUser(uid int64) (*UserExport, error) {
+	u, err := s.userRepo.ByID(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	exp := UserExport{ExportedAt: time.Now(), User: u}
+
+	if exp.Groups, err = s.groupRepo.ByUser(uid); err != nil {
+		return nil, err
+	}
+
+	if exp.Permissions, err = s.userRepo.Permissions(uid); err != nil {
+		return nil, err
+	}
+
+	if err := orm.List(s.db, &exp.ACLEntries, "where user_id = $1 order by id asc", uid); err != nil {
+		return nil, err
+	}
+
+	if err := orm.List(s.db, &exp.Relations, "where (subject_type = $1 and subject_id = $2 and subject_relation = '') or (object_type = $1 and object_id = $2)",
+		SubjectUser, strconv.FormatInt(uid, 10)); err != nil {
+		return nil, err
+	}
+
+	if err := orm.List(s.db, &exp.QuotaUsage, "where user_id = $1 order by window_start asc", uid); err != nil {
+		return nil, err
+	}
+
+	if err := orm.List(s.db, &exp.Invitations, "where user_id = $1 or email = $2 order by id asc", uid, u.Email); err != nil {
+		return nil, err
+	}
+
+	if exp.Sessions, err = s.sessionRepo.ByUserID(uid); err != nil {
+		return nil, err
+	}
+
+	if exp.Tokens, err = s.exportTokens(uid); err != nil {
+		return nil, err
+	}
+
+	if exp.Devices, err = s.userRepo.Devices(uid); err != nil {
+		return nil, err
+	}
+
+	if err := orm.List(s.db, &exp.LoginAttempts, "where user_id = $1 order by id asc", uid); err != nil {
+		return nil, err
+	}
+
+	if err := orm.List(s.db, &exp.AuditEntries, "where actor_id = $1 or target_id = $1 order by id asc", uid); err != nil {
+		return nil, err
+	}
+
+	if err := orm.List(s.db, &exp.Events, "where user_id = $1 order by id asc", uid); err != nil {
+		return nil, err
+	}
+
+	return &exp, nil
+}
+
+func (s *Service) exportTokens(uid int64) ([]ExportedToken, error) {
+	var (
+		tokens = make([]ExportedToken, 0)
+		pass   []PasswordResetToken
+		reg    []RegistrationToken
+		phone  []PhoneCode
+	)
+
+	if err := orm.List(s.db, &pass, "where user_id = $1", uid); err != nil {
+		return nil, err
+	}
+
+	for _, t := range pass {
+		tokens = append(tokens, ExportedToken{Type: "password_reset", Email: t.Email, Expires: t.Expires})
+	}
+
+	if err := orm.List(s.db, &reg, "where user_id = $1", uid); err != nil {
+		return nil, err
+	}
+
+	for _, t := range reg {
+		tokens = append(tokens, ExportedToken{Type: "registration", Email: t.Email, Expires: t.Expires})
+	}
+
+	if err := orm.List(s.db, &phone, "where user_id = $1", uid); err != nil {
+		return nil, err
+	}
+
+	for _, t := range phone {
+		tokens = append(tokens, ExportedToken{Type: "phone_" + string(t.Purpose), Phone: t.Phone, Expires: t.Expires})
+	}
+
+	return tokens, nil
+}
+
+// EraseUser deletes a user and everything that references them in a single transaction.
+// Audit entries and events are kept with their personal data and references to the user removed,
+// redacted audit entries keep their place in the hash chain and remain verifiable.
+// The erasure is recorded with a random erasure id which is not linked to the user.
+func (s *Service) EraseUser(uid int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := scrubUsers(tx, s.auditRepo, []int64{uid}); err != nil {
+		return err
+	}
+
+	// sessions, tokens, memberships, devices and login history cascade
+	res, err := tx.Exec("delete from users where id = $1", uid)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUserNotFound
+	}
+
+	erasureID, err := GenerateToken(16)
+	if err != nil {
+		return err
+	}
+
+	meta := map[string]any{"erasure_id": erasureID}
+	if err := addEvent(tx, EventUserErased, nil, meta); err != nil {
+		return err
+	}
+
+	if err := s.auditRepo.add(tx, s.userRepo.auditEntry(AuditUserErased, nil, meta)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// scrubUsers removes personal data of the users from audit entries, events, webhook deliveries and invitations,
+// and deletes the relation tuples of the users which are not removed along with the user row
+func scrubUsers(tx orm.QuerierExecuter, audit *AuditRepo, uids []int64) error {
+	if err := audit.redactUsers(tx, uids); err != nil {
+		return err
+	}
+
+	stmts := []string{
+		`update webhook_deliveries set payload = jsonb_set(payload, '{data}', '{"erased": true}')
+			where event_id in (select id from auth_events where user_id = any($1))`,
+		`update auth_events set payload = '{"erased": true}' where user_id = any($1)`,
+		`delete from invitations where user_id = any($1) or email in (select email from users where id = any($1))`,
+		`delete from relation_tuples where (subject_type = 'user' and subject_relation = '' and subject_id in (select unnest($1::bigint[])::text))
+			or (object_type = 'user' and object_id in (select unnest($1::bigint[])::text))`,
+	}
+
+	for _, sql := range stmts {
+		if err := orm.Exec(tx, sql, uids); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"math"
+	"net"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+var (
+	// MaxTravelSpeed is the speed in km/h above which travel between two logins is considered impossible
+	MaxTravelSpeed = 1000.0
+
+	// MinTravelDistance is the distance in km under which logins are never flagged,
+	// as ip geolocation is imprecise
+	MinTravelDistance = 500.0
+)
+
+// Location is the geographical location of an ip address
+type Location struct {
+	Country   string
+	City      string
+	Latitude  float64
+	Longitude float64
+}
+
+// GeoLocator is the interface implemented by ip geolocation providers
+type GeoLocator interface {
+	// Locate returns the location of the ip. Returns nil location when unknown
+	Locate(ip string) (*Location, error)
+}
+
+// MaxMindLocator looks up locations in a local MaxMind GeoLite2 / GeoIP2 City database (.mmdb)
+type MaxMindLocator struct{ db *maxminddb.Reader }
+
+// OpenMaxMind opens the .mmdb database at path
+func OpenMaxMind(path string) (*MaxMindLocator, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MaxMindLocator{db}, nil
+}
+
+// Locate is the implementation of the GeoLocator interface
+func (m *MaxMindLocator) Locate(ip string) (*Location, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, nil
+	}
+
+	var record struct {
+		City struct {
+			Names map[string]string `maxminddb:"names"`
+		} `maxminddb:"city"`
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+		Location struct {
+			Latitude  *float64 `maxminddb:"latitude"`
+			Longitude *float64 `maxminddb:"longitude"`
+		} `maxminddb:"location"`
+	}
+
+	if err := m.db.Lookup(addr, &record); err != nil {
+		return nil, err
+	}
+
+	if record.Location.Latitude == nil || record.Location.Longitude == nil {
+		return nil, nil
+	}
+
+	return &Location{
+		Country:   record.Country.ISOCode,
+		City:      record.City.Names["en"],
+		Latitude:  *record.Location.Latitude,
+		Longitude: *record.Location.Longitude,
+	}, nil
+}
+
+// Close closes the underlying database
+func (m *MaxMindLocator) Close() error {
+	return m.db.Close()
+}
+
+// Distance returns the great circle distance between two locations in km
+func Distance(a, b *Location) float64 {
+	const earthRadius = 6371.0
+
+	var (
+		lat1 = a.Latitude * math.Pi / 180
+		lat2 = b.Latitude * math.Pi / 180
+		dlat = lat2 - lat1
+		dlon = (b.Longitude - a.Longitude) * math.Pi / 180
+		h    = math.Sin(dlat/2)*math.Sin(dlat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dlon/2)*math.Sin(dlon/2)
+	)
+
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// ImpossibleTravel is true when going from one location to the other within elapsed
+// would require travelling faster than MaxTravelSpeed
+func ImpossibleTravel(from, to *Location, elapsed time.Duration) bool {
+	d := Distance(from, to)
+	if d < MinTravelDistance {
+		return false
+	}
+
+	hours := elapsed.Hours()
+	if hours <= 0 {
+		return true
+	}
+
+	return d/hours > MaxTravelSpeed
+}
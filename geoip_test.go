@@ -0,0 +1,68 @@
+package auth_test
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cristosal/auth"
+)
+
+var (
+	madrid  = &auth.Location{Latitude: 40.4168, Longitude: -3.7038}
+	newYork = &auth.Location{Latitude: 40.7128, Longitude: -74.0060}
+	toledo  = &auth.Location{Latitude: 39.8628, Longitude: -4.0273}
+)
+
+func TestDistance(t *testing.T) {
+	d := auth.Distance(madrid, newYork)
+	if math.Abs(d-5767) > 10 {
+		t.Fatalf("expected distance madrid to new york to be around 5767km got %f", d)
+	}
+}
+
+func TestImpossibleTravel(t *testing.T) {
+	if !auth.ImpossibleTravel(madrid, newYork, time.Hour) {
+		t.Fatal("expected madrid to new york in an hour to be impossible")
+	}
+
+	if auth.ImpossibleTravel(madrid, newYork, time.Hour*12) {
+		t.Fatal("expected madrid to new york in 12 hours to be possible")
+	}
+
+	if auth.ImpossibleTravel(madrid, toledo, time.Minute) {
+		t.Fatal("expected nearby locations never to be flagged")
+	}
+}
+
+func TestDeviceID(t *testing.T) {
+	var (
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/", nil)
+	)
+
+	id, err := auth.DeviceID(w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != id {
+		t.Fatal("expected device cookie to be set")
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+
+	same, err := auth.DeviceID(w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if same != id || len(w.Result().Cookies()) != 0 {
+		t.Fatal("expected existing device cookie to be reused")
+	}
+}
@@ -6,7 +6,10 @@ require (
 	github.com/cristosal/orm v0.0.4-beta
 	github.com/go-redis/redis/v7 v7.4.1
 	github.com/jackc/pgx/v5 v5.5.0
+	github.com/oschwald/maxminddb-golang v1.12.0
 	golang.org/x/crypto v0.15.0
+	golang.org/x/net v0.10.0
+	golang.org/x/text v0.14.0
 )
 
 require (
@@ -14,5 +17,5 @@ require (
 	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
 	github.com/jackc/puddle/v2 v2.2.1 // indirect
 	golang.org/x/sync v0.5.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
+	golang.org/x/sys v0.14.0 // indirect
 )
@@ -17,6 +17,7 @@ type (
 		Name        string
 		Description string
 		Priority    int
+		ParentID    *int64 `db:"parent_id,ro"` // members inherit the permissions of the parent, see GroupRepo.SetParent
 	}
 
 	Groups []Group
@@ -36,10 +37,30 @@ func (g *Group) NewPermission(p *Permission, v int) *GroupPermission {
 }
 
 // GroupRepo us a group repository using pgx
-type GroupRepo struct{ db orm.DB }
+type GroupRepo struct {
+	db    orm.DB
+	hooks *Hooks
+	audit *AuditRepo
+	actor *Session
+
+	// strategy resolves conflicts between groups, see UseStrategy
+	strategy PermissionStrategy
+}
 
 func NewGroupRepo(db orm.DB) *GroupRepo {
-	return &GroupRepo{db}
+	return &GroupRepo{db: db, hooks: new(Hooks)}
+}
+
+// Hooks returns the lifecycle hooks registry used by the repo
+func (r *GroupRepo) Hooks() *Hooks {
+	return r.hooks
+}
+
+// As returns a copy of the repo whose actions are attributed to the session in the audit log
+func (r *GroupRepo) As(sess *Session) *GroupRepo {
+	c := *r
+	c.actor = sess
+	return &c
 }
 
 // Seed seeds groups to the database.
@@ -79,12 +100,76 @@ func (r *GroupRepo) Seed(groups []Group) error {
 // AddUser adds a user to a group.
 // No error will occur if a user is already part of the group
 func (r *GroupRepo) AddUser(uid int64, gid int64) error {
-	return orm.Exec(r.db, "insert into group_users (user_id, group_id) values ($1, $2) on conflict do nothing", uid, gid)
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := r.addUser(tx, uid, gid); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// addUser adds a user to a group within the transaction
+func (r *GroupRepo) addUser(tx orm.QuerierExecuter, uid int64, gid int64) error {
+	m := &GroupMembership{UserID: uid, GroupID: gid}
+	return groupExecTx(tx, r, EventGroupUserAdded, &uid, m, &r.hooks.beforeAddUser, &r.hooks.afterAddUser,
+		"insert into group_users (user_id, group_id) values ($1, $2) on conflict do nothing", uid, gid)
 }
 
 // RemoveUser removes a user from a group
 func (r *GroupRepo) RemoveUser(uid int64, gid int64) error {
-	return orm.Exec(r.db, "delete from group_users where user_id = $1 and group_id = $2", uid, gid)
+	m := &GroupMembership{UserID: uid, GroupID: gid}
+	return groupExec(r, EventGroupUserRemoved, &uid, m, &r.hooks.beforeRemoveUser, &r.hooks.afterRemoveUser,
+		"delete from group_users where user_id = $1 and group_id = $2", uid, gid)
+}
+
+// groupExec executes the sql statement within a transaction, see groupExecTx
+func groupExec[T any](r *GroupRepo, typ EventType, uid *int64, v T, before, after *hookList[T], sql string, args ...any) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := groupExecTx(tx, r, typ, uid, v, before, after, sql, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// groupExecTx executes the sql statement running the before and after hooks with v.
+// After hooks, the event and the audit entry are only run when rows were affected.
+func groupExecTx[T any](tx orm.QuerierExecuter, r *GroupRepo, typ EventType, uid *int64, v T, before, after *hookList[T], sql string, args ...any) error {
+	if err := before.run(tx, v); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(sql, args...)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	if err := after.run(tx, v); err != nil {
+		return err
+	}
+
+	if err := addEvent(tx, typ, uid, v); err != nil {
+		return err
+	}
+
+	// audit actions share the names of events
+	return r.audit.add(tx, NewAuditEntry(r.actor, AuditAction(typ), uid, v))
 }
 
 // GroupByName finds a group by it's name
@@ -114,7 +199,7 @@ func (r *GroupRepo) Remove(gid int64) error {
 // GroupsByUser returns all groups that user is a part of
 func (r *GroupRepo) ByUser(uid int64) (Groups, error) {
 	var groups []Group
-	if err := orm.List(r.db, &groups, "inner join group_users gu on gu.user_id = $1", uid); err != nil {
+	if err := orm.List(r.db, &groups, "inner join group_users gu on gu.group_id = groups.id and gu.user_id = $1", uid); err != nil {
 		return nil, err
 	}
 
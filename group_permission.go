@@ -1,8 +1,6 @@
 package auth
 
-import (
-	"github.com/cristosal/orm"
-)
+import "database/sql"
 
 // GroupPermission represents the union between a group and a permission
 // it can contains a value for use in application logic
@@ -12,6 +10,10 @@ type GroupPermission struct {
 	Priority     int    `db:"-"` // group priority value
 	Name         string `db:"-"` // permission name
 	Value        int
+	Deny         bool           // explicit denial, see PermissionStrategy
+	Type         PermissionType `db:"-"` // permission type
+	Window       QuotaWindow    `db:"-"` // reset window of quantity permissions
+	Direct       bool           `db:"-"` // granted or denied to the user directly, see UserPermission
 }
 
 func (*GroupPermission) TableName() string {
@@ -20,41 +22,177 @@ func (*GroupPermission) TableName() string {
 
 type GroupPermissions []GroupPermission
 
-// Value returns the value associated with the permission of a given name.
-// it takes into account conflicting permissions and takes the one with higher priority
-func (gps GroupPermissions) Value(name string) int {
-	var (
-		priority *int
-		value    = 0
-	)
+// PermissionSource describes where the effective value of a permission comes from
+type PermissionSource string
+
+const (
+	SourceNone      PermissionSource = "none"       // the user does not have the permission
+	SourceUserDeny  PermissionSource = "user_deny"  // the permission was denied to the user directly
+	SourceUserGrant PermissionSource = "user_grant" // the permission was granted to the user directly
+	SourceGroupDeny PermissionSource = "group_deny" // the permission was denied through a group
+	SourceGroup     PermissionSource = "group"      // the permission was granted through a group
+)
+
+// PermissionExplanation shows how the effective value of a permission was resolved
+type PermissionExplanation struct {
+	Name    string
+	Granted bool
+	Value   int
+	Source  PermissionSource
+	Winner  *GroupPermission // entry providing the value, nil when no entry matched
+	Entries GroupPermissions // all entries for the permission, see SortPermissions for their order
+}
+
+// Explain resolves the permission of a given name using StrategyPriority, see ExplainWith.
+// Permissions returned by GroupRepo.UserPermissions are already resolved with the strategy of the repo.
+func (gps GroupPermissions) Explain(name string) *PermissionExplanation {
+	return gps.ExplainWith(name, StrategyPriority)
+}
+
+// ExplainWith resolves the permission of a given name.
+// A direct denial takes precedence over a direct grant which takes precedence over groups.
+// Conflicts between groups are resolved by the strategy.
+func (gps GroupPermissions) ExplainWith(name string, strategy PermissionStrategy) *PermissionExplanation {
+	e := PermissionExplanation{Name: name, Source: SourceNone}
 
 	for i := range gps {
-		if gps[i].Name == name && (priority == nil || gps[i].Priority > *priority) {
-			priority = &gps[i].Priority
-			value = gps[i].Value
+		if gps[i].Name == name {
+			e.Entries = append(e.Entries, gps[i])
+		}
+	}
+
+	SortPermissions(e.Entries)
+
+	// direct entries are sorted first with denials before grants
+	direct := 0
+	for direct < len(e.Entries) && e.Entries[direct].Direct {
+		direct++
+	}
+
+	if direct > 0 {
+		e.Winner = &e.Entries[0]
+		if e.Winner.Deny {
+			e.Source = SourceUserDeny
+		} else {
+			e.Source = SourceUserGrant
+			e.Granted = true
+			e.Value = e.Winner.Value
 		}
+
+		return &e
+	}
+
+	if len(e.Entries) == 0 {
+		return &e
 	}
 
-	return value
+	var value int
+	if e.Winner, value = strategy(e.Entries); e.Winner == nil {
+		return &e
+	}
+
+	if e.Winner.Deny {
+		e.Source = SourceGroupDeny
+	} else {
+		e.Source = SourceGroup
+		e.Granted = true
+		e.Value = value
+	}
+
+	return &e
+}
+
+// Value returns the value associated with the permission of a given name, see Explain
+func (gps GroupPermissions) Value(name string) int {
+	return gps.Explain(name).Value
 }
 
+// Has returns true when the permission of a given name is granted and not denied, see Explain
 func (gps GroupPermissions) Has(name string) bool {
-	for i := range gps {
-		if gps[i].Name == name {
-			return true
+	return gps.Explain(name).Granted
+}
+
+// resolve replaces the group entries of every permission with the entry winning under the strategy,
+// carrying the resolved value. Direct entries are kept as they take precedence over groups.
+func (gps GroupPermissions) resolve(strategy PermissionStrategy) GroupPermissions {
+	var (
+		resolved = make(GroupPermissions, 0, len(gps))
+		byName   = make(map[string]GroupPermissions)
+		names    []string
+	)
+
+	for _, gp := range gps {
+		if gp.Direct {
+			resolved = append(resolved, gp)
+			continue
+		}
+
+		if _, ok := byName[gp.Name]; !ok {
+			names = append(names, gp.Name)
+		}
+
+		byName[gp.Name] = append(byName[gp.Name], gp)
+	}
+
+	for _, name := range names {
+		entries := byName[name]
+		SortPermissions(entries)
+
+		winner, value := strategy(entries)
+		if winner == nil {
+			continue
 		}
+
+		gp := *winner
+		gp.Value = value
+		resolved = append(resolved, gp)
 	}
 
-	return false
+	return resolved
+}
+
+// UseStrategy sets the strategy resolving conflicts between groups in UserPermissions.
+// A nil strategy uses StrategyPriority.
+func (r *GroupRepo) UseStrategy(strategy PermissionStrategy) {
+	r.strategy = strategy
 }
 
+// Strategy returns the strategy resolving conflicts between groups, see UseStrategy
+func (r *GroupRepo) Strategy() PermissionStrategy {
+	if r.strategy == nil {
+		return StrategyPriority
+	}
+
+	return r.strategy
+}
+
+// UserPermissions returns the permissions of the groups a user is part of,
+// including the permissions inherited from the ancestors of those groups,
+// along with the unexpired permissions granted or denied to the user directly.
+// When a strategy is set with UseStrategy, conflicts between groups are resolved with it
+// leaving a single group entry per permission, so that Has and Value agree with the strategy.
 func (r *GroupRepo) UserPermissions(uid int64) (GroupPermissions, error) {
-	sql := `select 
+	gps, err := r.userPermissionEntries(uid)
+	if err != nil || r.strategy == nil {
+		return gps, err
+	}
+
+	return gps.resolve(r.strategy), nil
+}
+
+// userPermissionEntries returns every group and direct entry of the permissions of a user
+func (r *GroupRepo) userPermissionEntries(uid int64) (GroupPermissions, error) {
+	sql := userGroupsCTE + `
+	select 
 		gp.group_id, 
 		gp.permission_id, 
 		g.priority,
 		p.name,
-		gp.value
+		gp.value,
+		gp.deny,
+		p.type,
+		p.quota_window,
+		false
 	from 
 		group_permissions gp 
 	inner join 
@@ -66,38 +204,35 @@ func (r *GroupRepo) UserPermissions(uid int64) (GroupPermissions, error) {
 	on
 		g.id = gp.group_id
 	inner join
-		group_users gu
+		user_groups ug
 	on
-		gu.group_id = g.id
-	where 
-		gu.user_id = $1`
+		ug.id = g.id
+	union all
+	select
+		0,
+		up.permission_id,
+		0,
+		p.name,
+		up.value,
+		up.deny,
+		p.type,
+		p.quota_window,
+		true
+	from
+		user_permissions up
+	inner join
+		permissions p
+	on
+		p.id = up.permission_id
+	where
+		up.user_id = $1 and (up.expires_at is null or up.expires_at > now())`
 
 	rows, err := r.db.Query(sql, uid)
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
-	groupPermissions := make([]GroupPermission, 0)
-
-	for rows.Next() {
-		var gp GroupPermission
-		err := rows.Scan(
-			&gp.GroupID,
-			&gp.PermissionID,
-			&gp.Priority,
-			&gp.Name,
-			&gp.Value,
-		)
-
-		if err != nil {
-			return nil, err
-		}
-
-		groupPermissions = append(groupPermissions, gp)
-	}
-
-	return groupPermissions, nil
+	return scanGroupPermissions(rows)
 }
 
 // Permissions returns group permissions for a group by group id
@@ -107,7 +242,11 @@ func (r *GroupRepo) Permissions(gid int64) (GroupPermissions, error) {
 		gp.permission_id, 
 		g.priority,
 		p.name,
-		gp.value
+		gp.value,
+		gp.deny,
+		p.type,
+		p.quota_window,
+		false
 	from 
 		group_permissions gp 
 	inner join 
@@ -126,6 +265,10 @@ func (r *GroupRepo) Permissions(gid int64) (GroupPermissions, error) {
 		return nil, err
 	}
 
+	return scanGroupPermissions(rows)
+}
+
+func scanGroupPermissions(rows *sql.Rows) (GroupPermissions, error) {
 	defer rows.Close()
 	groupPermissions := make([]GroupPermission, 0)
 
@@ -137,6 +280,10 @@ func (r *GroupRepo) Permissions(gid int64) (GroupPermissions, error) {
 			&gp.Priority,
 			&gp.Name,
 			&gp.Value,
+			&gp.Deny,
+			&gp.Type,
+			&gp.Window,
+			&gp.Direct,
 		)
 
 		if err != nil {
@@ -146,13 +293,23 @@ func (r *GroupRepo) Permissions(gid int64) (GroupPermissions, error) {
 		groupPermissions = append(groupPermissions, gp)
 	}
 
-	return groupPermissions, nil
+	return groupPermissions, rows.Err()
 }
 
 func (r *GroupRepo) AddPermission(gid, pid int64, value int) error {
-	return orm.Exec(r.db, "insert into group_permissions (group_id, permission_id, value) values ($1, $2, $3) on conflict do nothing", gid, pid, value)
+	return groupExec(r, EventGroupPermissionAdded, nil, map[string]any{"group_id": gid, "permission_id": pid, "value": value}, nil, nil,
+		"insert into group_permissions (group_id, permission_id, value) values ($1, $2, $3) on conflict do nothing", gid, pid, value)
+}
+
+// DenyPermission explicitly denies a permission to the members of a group, replacing any grant of the group.
+// How denials of groups weigh against grants of other groups depends on the PermissionStrategy.
+func (r *GroupRepo) DenyPermission(gid, pid int64) error {
+	return groupExec(r, EventGroupPermissionAdded, nil, map[string]any{"group_id": gid, "permission_id": pid, "deny": true}, nil, nil,
+		`insert into group_permissions (group_id, permission_id, value, deny) values ($1, $2, 0, true)
+		on conflict (group_id, permission_id) do update set value = 0, deny = true where not group_permissions.deny`, gid, pid)
 }
 
 func (r *GroupRepo) RemovePermission(gid, pid int64) error {
-	return orm.Exec(r.db, "delete from group_permissions where group_id = $1 and permission_id = $2", gid, pid)
+	return groupExec(r, EventGroupPermissionRemoved, nil, map[string]any{"group_id": gid, "permission_id": pid}, nil, nil,
+		"delete from group_permissions where group_id = $1 and permission_id = $2", gid, pid)
 }
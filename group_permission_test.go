@@ -0,0 +1,142 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/cristosal/auth"
+)
+
+func TestGroupPermissionsExplain(t *testing.T) {
+	perms := auth.GroupPermissions{
+		{GroupID: 1, Name: "upload", Priority: 1, Value: 10},
+		{GroupID: 2, Name: "upload", Priority: 5, Value: 50},
+		{GroupID: 3, Name: "export", Priority: 1, Value: 1},
+		{Name: "export", Direct: true, Value: 3},
+		{GroupID: 1, Name: "delete", Priority: 9, Value: 1},
+		{Name: "delete", Direct: true, Deny: true},
+	}
+
+	tt := []struct {
+		name    string
+		granted bool
+		value   int
+		source  auth.PermissionSource
+	}{
+		{"upload", true, 50, auth.SourceGroup},
+		{"export", true, 3, auth.SourceUserGrant},
+		{"delete", false, 0, auth.SourceUserDeny},
+		{"missing", false, 0, auth.SourceNone},
+	}
+
+	for _, tc := range tt {
+		e := perms.Explain(tc.name)
+		if e.Granted != tc.granted || e.Value != tc.value || e.Source != tc.source {
+			t.Fatalf("%s: expected %v %d %s got %v %d %s", tc.name, tc.granted, tc.value, tc.source, e.Granted, e.Value, e.Source)
+		}
+
+		if perms.Has(tc.name) != tc.granted || perms.Value(tc.name) != tc.value {
+			t.Fatalf("%s: expected Has and Value to match explanation", tc.name)
+		}
+	}
+
+	if e := perms.Explain("upload"); e.Winner.GroupID != 2 || len(e.Entries) != 2 {
+		t.Fatalf("expected group 2 to win out of 2 entries got %+v", e)
+	}
+}
+
+func TestPermissionStrategies(t *testing.T) {
+	var (
+		low     = auth.GroupPermission{GroupID: 1, Name: "storage", Priority: 1, Value: 10, Type: auth.Quantity}
+		high    = auth.GroupPermission{GroupID: 2, Name: "storage", Priority: 5, Value: 5, Type: auth.Quantity}
+		tied    = auth.GroupPermission{GroupID: 3, Name: "storage", Priority: 5, Value: 7, Type: auth.Quantity}
+		lowDeny = auth.GroupPermission{GroupID: 4, Name: "storage", Priority: 1, Deny: true}
+		tieDeny = auth.GroupPermission{GroupID: 5, Name: "storage", Priority: 5, Deny: true}
+		access  = auth.GroupPermission{GroupID: 6, Name: "storage", Priority: 1, Value: 1, Type: auth.Access}
+		access2 = auth.GroupPermission{GroupID: 7, Name: "storage", Priority: 3, Value: 2, Type: auth.Access}
+	)
+
+	tt := []struct {
+		name     string
+		strategy auth.PermissionStrategy
+		entries  auth.GroupPermissions
+		granted  bool
+		value    int
+		winner   int64
+	}{
+		{"priority", auth.StrategyPriority, auth.GroupPermissions{low, high}, true, 5, 2},
+		{"priority tie lower group id", auth.StrategyPriority, auth.GroupPermissions{tied, low, high}, true, 5, 2},
+		{"priority ignores lower deny", auth.StrategyPriority, auth.GroupPermissions{lowDeny, high}, true, 5, 2},
+		{"priority tie deny", auth.StrategyPriority, auth.GroupPermissions{high, tieDeny}, false, 0, 5},
+		{"deny overrides", auth.StrategyDenyOverrides, auth.GroupPermissions{high, lowDeny}, false, 0, 4},
+		{"deny overrides without deny", auth.StrategyDenyOverrides, auth.GroupPermissions{low, high}, true, 5, 2},
+		{"max", auth.StrategyMax, auth.GroupPermissions{high, low, tied}, true, 10, 1},
+		{"max deny", auth.StrategyMax, auth.GroupPermissions{high, lowDeny}, false, 0, 4},
+		{"min", auth.StrategyMin, auth.GroupPermissions{tied, low, high}, true, 5, 2},
+		{"sum", auth.StrategySum, auth.GroupPermissions{low, high, tied}, true, 22, 2},
+		{"sum deny", auth.StrategySum, auth.GroupPermissions{low, lowDeny}, false, 0, 4},
+		{"sum access", auth.StrategySum, auth.GroupPermissions{access, access2}, true, 2, 7},
+		{"user grant beats group deny", auth.StrategyDenyOverrides, auth.GroupPermissions{tieDeny, {Name: "storage", Direct: true, Value: 3}}, true, 3, 0},
+	}
+
+	for _, tc := range tt {
+		e := tc.entries.ExplainWith("storage", tc.strategy)
+		if e.Granted != tc.granted || e.Value != tc.value {
+			t.Fatalf("%s: expected %v %d got %v %d", tc.name, tc.granted, tc.value, e.Granted, e.Value)
+		}
+
+		if e.Winner == nil || e.Winner.GroupID != tc.winner {
+			t.Fatalf("%s: expected group %d to win got %+v", tc.name, tc.winner, e.Winner)
+		}
+	}
+}
+
+func TestSortPermissionsDeterministic(t *testing.T) {
+	a := auth.GroupPermissions{
+		{GroupID: 3, Priority: 1},
+		{GroupID: 1, Priority: 1},
+		{GroupID: 2, Priority: 1, Deny: true},
+		{Priority: 0, Direct: true},
+	}
+
+	b := auth.GroupPermissions{a[2], a[0], a[3], a[1]}
+
+	auth.SortPermissions(a)
+	auth.SortPermissions(b)
+
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("expected same order regardless of input order, got %v and %v", a, b)
+		}
+	}
+
+	if !a[0].Direct || !a[1].Deny || a[2].GroupID != 1 {
+		t.Fatalf("unexpected order %v", a)
+	}
+}
+
+func TestGroupPermissionsResolve(t *testing.T) {
+	perms := auth.GroupPermissions{
+		{GroupID: 1, Name: "storage", Priority: 1, Value: 10, Type: auth.Quantity},
+		{GroupID: 2, Name: "storage", Priority: 5, Value: 5, Type: auth.Quantity},
+		{GroupID: 1, Name: "upload", Priority: 9, Value: 1},
+		{GroupID: 2, Name: "upload", Priority: 1, Deny: true},
+		{Name: "export", Direct: true, Value: 3},
+	}
+
+	resolved := perms.Resolve(auth.StrategySum)
+	if len(resolved) != 3 {
+		t.Fatalf("expected one entry per permission got %v", resolved)
+	}
+
+	if v := resolved.Value("storage"); v != 15 {
+		t.Fatalf("expected summed storage of 15 got %d", v)
+	}
+
+	if resolved.Has("upload") || !resolved.Has("export") {
+		t.Fatalf("expected upload denied and export granted got %v", resolved)
+	}
+
+	if e := resolved.Explain("storage"); e.Source != auth.SourceGroup || e.Winner.GroupID != 2 {
+		t.Fatalf("expected storage from group 2 got %+v", e)
+	}
+}
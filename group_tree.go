@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/cristosal/orm"
+)
+
+// groupTreeLockKey is the advisory lock serializing changes to group parents
+const groupTreeLockKey = 7305598118
+
+// userGroupsCTE selects the groups of the user given as $1 along with their ancestors as user_groups
+const userGroupsCTE = `with recursive user_groups (id) as (
+		select group_id from group_users where user_id = $1
+		union
+		select g.parent_id from groups g inner join user_groups ug on ug.id = g.id where g.parent_id is not null
+	)`
+
+// SetParent makes parent the parent group of gid, members of gid inherit the permissions of parent and its ancestors.
+// A nil parent makes the group a top level group.
+// Returns ErrGroupCycle when parent is the group itself or one of its subgroups.
+func (r *GroupRepo) SetParent(gid int64, parent *int64) error {
+	if parent != nil && *parent == gid {
+		return ErrGroupCycle
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := orm.Exec(tx, "select pg_advisory_xact_lock($1)", groupTreeLockKey); err != nil {
+		return err
+	}
+
+	var found int
+	if err := tx.QueryRow("select count(*) from groups where id = $1 or id = $2", gid, parent).Scan(&found); err != nil {
+		return err
+	}
+
+	if (parent == nil && found != 1) || (parent != nil && found != 2) {
+		return ErrGroupNotFound
+	}
+
+	if parent != nil {
+		var cycle bool
+		row := tx.QueryRow(`with recursive ancestors (id) as (
+			select $1::int
+			union
+			select g.parent_id from groups g inner join ancestors a on a.id = g.id where g.parent_id is not null
+		) select exists (select 1 from ancestors where id = $2)`, *parent, gid)
+
+		if err := row.Scan(&cycle); err != nil {
+			return err
+		}
+
+		if cycle {
+			return ErrGroupCycle
+		}
+	}
+
+	meta := map[string]any{"group_id": gid, "parent_id": parent}
+	err = groupExecTx(tx, r, EventGroupParentChanged, nil, meta, nil, nil,
+		"update groups set parent_id = $1 where id = $2 and parent_id is distinct from $1", parent, gid)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Subgroups returns all groups nested below the group ordered by name
+func (r *GroupRepo) Subgroups(gid int64) (Groups, error) {
+	var groups []Group
+	cols := orm.Columns(&Group{}).PrefixedList("g")
+	sql := fmt.Sprintf(`with recursive subgroups (id) as (
+		select id from groups where parent_id = $1
+		union
+		select g.id from groups g inner join subgroups s on g.parent_id = s.id
+	) select %s from groups g inner join subgroups s on s.id = g.id order by g.name`, cols)
+
+	if err := orm.Query(r.db, &groups, sql, gid); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// MemberScope selects the members of a group returned by UserRepo.ByGroup
+type MemberScope int
+
+const (
+	DirectMembers    MemberScope = iota // users added to the group itself
+	IncludeSubgroups                    // users of the group or any of its subgroups
+)
+
+// byGroupTree returns the users belonging to a group or any of its subgroups
+func (r *UserRepo) byGroupTree(gid int64) ([]User, error) {
+	cols := orm.Columns(&User{}).PrefixedList("u")
+	sql := fmt.Sprintf(`with recursive tree (id) as (
+		select $1::int
+		union
+		select g.id from groups g inner join tree t on g.parent_id = t.id
+	) select %s from users u where exists (
+		select 1 from group_users gu inner join tree t on t.id = gu.group_id where gu.user_id = u.id
+	)`, cols)
+
+	var users []User
+	if err := orm.Query(r.db, &users, sql, gid); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
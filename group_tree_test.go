@@ -0,0 +1,86 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cristosal/auth"
+)
+
+func TestGroupTree(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	groups := []auth.Group{
+		{Name: "tree_engineering", Description: "engineering"},
+		{Name: "tree_backend", Description: "backend"},
+	}
+
+	perm := auth.Permission{Name: "tree_deploy"}
+
+	t.Cleanup(func() {
+		for i := range groups {
+			svc.Groups().Remove(groups[i].ID)
+		}
+
+		svc.Permissions().RemoveByName(perm.Name)
+	})
+
+	if err := svc.Groups().Seed(groups); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Permissions().Add(&perm); err != nil {
+		t.Fatal(err)
+	}
+
+	parent, child := groups[0].ID, groups[1].ID
+	if err := svc.Groups().AddPermission(parent, perm.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Groups().SetParent(child, &parent); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Groups().SetParent(parent, &child); !errors.Is(err, auth.ErrGroupCycle) {
+		t.Fatalf("expected cycle error got %v", err)
+	}
+
+	if err := svc.Groups().SetParent(parent, &parent); !errors.Is(err, auth.ErrGroupCycle) {
+		t.Fatalf("expected cycle error got %v", err)
+	}
+
+	res, err := svc.Users().Register(&auth.RegistrationRequest{Name: "Tree User", Email: "tree@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		svc.EraseUser(res.UserID)
+	})
+
+	if err := svc.Groups().AddUser(res.UserID, child); err != nil {
+		t.Fatal(err)
+	}
+
+	perms, err := svc.Groups().UserPermissions(res.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !perms.Has(perm.Name) {
+		t.Fatal("expected permission to be inherited from parent group")
+	}
+
+	users, err := svc.Users().ByGroup(parent, auth.IncludeSubgroups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(users) != 1 || users[0].ID != res.UserID {
+		t.Fatalf("expected subgroup member got %v", users)
+	}
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"sync"
+
+	"github.com/cristosal/orm"
+)
+
+// Hook is run before or after a lifecycle operation within the operations transaction.
+// Returning an error from a hook aborts the operation and rolls back the transaction.
+type Hook[T any] func(tx orm.QuerierExecuter, v T) error
+
+type hookList[T any] struct {
+	mu    sync.RWMutex
+	hooks []Hook[T]
+}
+
+func (l *hookList[T]) add(h Hook[T]) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, h)
+}
+
+// run executes the hooks in the order they were registered, stopping at the first error
+func (l *hookList[T]) run(tx orm.QuerierExecuter, v T) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.RLock()
+	hooks := l.hooks
+	l.mu.RUnlock()
+
+	for _, h := range hooks {
+		if err := h(tx, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GroupMembership is passed to group membership hooks
+type GroupMembership struct {
+	UserID  int64 `json:"user_id"`
+	GroupID int64 `json:"group_id"`
+}
+
+// Hooks is a registry of functions run before and after user lifecycle operations.
+//
+// Hooks run in the order they were registered.
+// Before hooks run within the operations transaction prior to any change and can veto it by returning an error.
+// After hooks run within the same transaction once the change has been made, an error rolls back the operation.
+type Hooks struct {
+	beforeRegister            hookList[*RegistrationRequest]
+	afterRegister             hookList[*RegistrationResponse]
+	beforeConfirmRegistration hookList[*User]
+	afterConfirmRegistration  hookList[*User]
+	beforeAuthenticate        hookList[*User]
+	afterAuthenticate         hookList[*User]
+	beforePasswordReset       hookList[*User]
+	afterPasswordReset        hookList[*User]
+	beforeAddUser             hookList[*GroupMembership]
+	afterAddUser              hookList[*GroupMembership]
+	beforeRemoveUser          hookList[*GroupMembership]
+	afterRemoveUser           hookList[*GroupMembership]
+}
+
+// BeforeRegister runs h with the sanitized registration request before the user is created.
+// The password is not included in the request.
+func (h *Hooks) BeforeRegister(fn Hook[*RegistrationRequest]) {
+	h.beforeRegister.add(fn)
+}
+
+// AfterRegister runs h once the user and registration token have been created
+func (h *Hooks) AfterRegister(fn Hook[*RegistrationResponse]) {
+	h.afterRegister.add(fn)
+}
+
+// BeforeConfirmRegistration runs h with the unconfirmed user once the token has been validated
+func (h *Hooks) BeforeConfirmRegistration(fn Hook[*User]) {
+	h.beforeConfirmRegistration.add(fn)
+}
+
+// AfterConfirmRegistration runs h with the confirmed user
+func (h *Hooks) AfterConfirmRegistration(fn Hook[*User]) {
+	h.afterConfirmRegistration.add(fn)
+}
+
+// BeforeAuthenticate runs h once the users credentials have been verified, before the login is recorded
+func (h *Hooks) BeforeAuthenticate(fn Hook[*User]) {
+	h.beforeAuthenticate.add(fn)
+}
+
+// AfterAuthenticate runs h once the login has been recorded
+func (h *Hooks) AfterAuthenticate(fn Hook[*User]) {
+	h.afterAuthenticate.add(fn)
+}
+
+// BeforeConfirmPasswordReset runs h with the user once the reset token has been validated
+func (h *Hooks) BeforeConfirmPasswordReset(fn Hook[*User]) {
+	h.beforePasswordReset.add(fn)
+}
+
+// AfterConfirmPasswordReset runs h once the password has been changed
+func (h *Hooks) AfterConfirmPasswordReset(fn Hook[*User]) {
+	h.afterPasswordReset.add(fn)
+}
+
+// BeforeAddUser runs h before a user is added to a group
+func (h *Hooks) BeforeAddUser(fn Hook[*GroupMembership]) {
+	h.beforeAddUser.add(fn)
+}
+
+// AfterAddUser runs h once a user has been added to a group.
+// It does not run when the user was already part of the group.
+func (h *Hooks) AfterAddUser(fn Hook[*GroupMembership]) {
+	h.afterAddUser.add(fn)
+}
+
+// BeforeRemoveUser runs h before a user is removed from a group
+func (h *Hooks) BeforeRemoveUser(fn Hook[*GroupMembership]) {
+	h.beforeRemoveUser.add(fn)
+}
+
+// AfterRemoveUser runs h once a user has been removed from a group.
+// It does not run when the user was not part of the group.
+func (h *Hooks) AfterRemoveUser(fn Hook[*GroupMembership]) {
+	h.afterRemoveUser.add(fn)
+}
@@ -0,0 +1,113 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cristosal/auth"
+	"github.com/cristosal/orm"
+)
+
+func TestHooksOrder(t *testing.T) {
+	var (
+		h     auth.Hooks
+		order []int
+	)
+
+	for i := 1; i <= 3; i++ {
+		i := i
+		h.BeforeAddUser(func(tx orm.QuerierExecuter, m *auth.GroupMembership) error {
+			order = append(order, i)
+			return nil
+		})
+	}
+
+	if err := h.RunBeforeAddUser(&auth.GroupMembership{UserID: 1, GroupID: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(order) != 3 || order[0] != 1 || order[1] != 2 || order[2] != 3 {
+		t.Fatalf("expected hooks to run in registration order got %v", order)
+	}
+}
+
+func TestHooksVeto(t *testing.T) {
+	var (
+		h      auth.Hooks
+		called = false
+		errTmp = errors.New("disposable email domain")
+	)
+
+	h.BeforeRegister(func(tx orm.QuerierExecuter, req *auth.RegistrationRequest) error {
+		if req.Email == "pepe@mailinator.com" {
+			return errTmp
+		}
+		return nil
+	})
+
+	h.BeforeRegister(func(tx orm.QuerierExecuter, req *auth.RegistrationRequest) error {
+		called = true
+		return nil
+	})
+
+	err := h.RunBeforeRegister(&auth.RegistrationRequest{Email: "pepe@mailinator.com"})
+	if !errors.Is(err, errTmp) {
+		t.Fatalf("expected veto error got %v", err)
+	}
+
+	if called {
+		t.Fatal("expected hooks after veto not to run")
+	}
+
+	if err := h.RunBeforeRegister(&auth.RegistrationRequest{Email: "pepe@gmail.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !called {
+		t.Fatal("expected second hook to run")
+	}
+}
+
+func TestHooksNil(t *testing.T) {
+	if err := auth.RunNilHooks(nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBeforeRegisterRollback(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		email    = "hook-veto@example.com"
+		errTmp   = errors.New("registrations are closed")
+		inserted bool
+	)
+
+	svc.Hooks().BeforeRegister(func(tx orm.QuerierExecuter, req *auth.RegistrationRequest) error {
+		if req.Password != "" {
+			t.Error("expected password not to be passed to hooks")
+		}
+
+		// written within the registration transaction, rolled back on veto
+		if _, err := tx.Exec("insert into users (name, email, phone, password) values ('Hook', $1, '', '')", "hook-side-effect@example.com"); err != nil {
+			return err
+		}
+
+		inserted = true
+		return errTmp
+	})
+
+	_, err := svc.Users().Register(&auth.RegistrationRequest{Name: "Hook Veto", Email: email, Password: "password123"})
+	if !errors.Is(err, errTmp) || !inserted {
+		t.Fatalf("expected veto error after the side effect got %v", err)
+	}
+
+	for _, e := range []string{email, "hook-side-effect@example.com"} {
+		if _, err := svc.Users().ByEmail(e); !errors.Is(err, auth.ErrUserNotFound) {
+			t.Fatalf("expected %s to be rolled back got %v", e, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"time"
+)
+
+// PermissionImpersonate allows users to impersonate other users, see Service.Impersonate
+const PermissionImpersonate = "impersonate_users"
+
+// ImpersonationDuration is the maximum lifetime of an impersonation session
+var ImpersonationDuration = time.Minute * 30
+
+// Impersonate returns a new session for the target user on behalf of the admin session.
+// The admin must be granted PermissionImpersonate through their groups. Users who can impersonate
+// can not be impersonated themselves and impersonated sessions can not impersonate again.
+// The session expires after ImpersonationDuration or with the admin session, whichever is first,
+// and is marked with the impersonator so that applications can show it, see Session.IsImpersonated.
+// Audit entries of the session are attributed to the impersonator.
+func (s *Service) Impersonate(admin *Session, targetUID int64) (*Session, error) {
+	if admin == nil || !admin.IsAuthorized() {
+		return nil, ErrUnauthorized
+	}
+
+	if admin.IsImpersonated() || admin.User.ID == targetUID {
+		return nil, ErrForbidden
+	}
+
+	perms, err := s.groupRepo.UserPermissions(admin.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !perms.Has(PermissionImpersonate) {
+		return nil, ErrForbidden
+	}
+
+	target, err := s.userRepo.ByID(targetUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := target.CheckStatus(); err != nil {
+		return nil, err
+	}
+
+	sess, err := s.userSession(target, time.Now().Add(ImpersonationDuration))
+	if err != nil {
+		return nil, err
+	}
+
+	if sess.Permissions.Has(PermissionImpersonate) {
+		return nil, ErrForbidden
+	}
+
+	if !admin.ExpiresAt.IsZero() && admin.ExpiresAt.Before(sess.ExpiresAt) {
+		sess.ExpiresAt = admin.ExpiresAt
+	}
+
+	sess.IP = admin.IP
+	sess.UserAgent = admin.UserAgent
+	sess.DeviceID = admin.DeviceID
+	sess.Impersonator = admin.User
+	sess.ImpersonatorSessionID = admin.ID
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if err := saveSession(tx, sess); err != nil {
+		return nil, err
+	}
+
+	meta := map[string]any{"expires_at": sess.ExpiresAt}
+	if err := s.auditRepo.add(tx, NewAuditEntry(admin, AuditImpersonationStarted, &targetUID, meta)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+// StopImpersonation ends an impersonated session and returns the original session of the impersonator.
+// Returns ErrNotImpersonating when the session is not impersonated.
+func (s *Service) StopImpersonation(sess *Session) (*Session, error) {
+	if sess == nil || !sess.IsImpersonated() {
+		return nil, ErrNotImpersonating
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("delete from sessions where id = $1", sess.ID); err != nil {
+		return nil, err
+	}
+
+	if err := s.auditRepo.add(tx, NewAuditEntry(sess, AuditImpersonationStopped, sess.UserID(), nil)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.sessionRepo.ByID(sess.ImpersonatorSessionID)
+}
+
+// userSession returns an unsaved session for the user with their groups and permissions
+func (s *Service) userSession(u *User, expiresAt time.Time) (*Session, error) {
+	sess := NewSession(expiresAt)
+	sess.User = u
+
+	var err error
+	if sess.Groups, err = s.groupRepo.ByUser(u.ID); err != nil {
+		return nil, err
+	}
+
+	if sess.Permissions, err = s.groupRepo.UserPermissions(u.ID); err != nil {
+		return nil, err
+	}
+
+	return &sess, nil
+}
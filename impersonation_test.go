@@ -0,0 +1,143 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cristosal/auth"
+)
+
+func TestImpersonation(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	groups := []auth.Group{{Name: "impersonation_support", Description: "support"}}
+	perms := []auth.Permission{{Name: auth.PermissionImpersonate}}
+
+	t.Cleanup(func() {
+		svc.Groups().Remove(groups[0].ID)
+	})
+
+	if err := svc.Groups().Seed(groups); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Permissions().Seed(perms); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Groups().AddPermission(groups[0].ID, perms[0].ID, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	register := func(email string) *auth.User {
+		res, err := svc.Users().Register(&auth.RegistrationRequest{Name: "Impersonation", Email: email, Password: "password123"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { svc.EraseUser(res.UserID) })
+
+		u, err := svc.Users().ByID(res.UserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return u
+	}
+
+	login := func(u *auth.User, ttl time.Duration) *auth.Session {
+		sess := auth.NewSession(time.Now().Add(ttl))
+		sess.User = u
+		if err := svc.Sessions().Save(&sess); err != nil {
+			t.Fatal(err)
+		}
+
+		return &sess
+	}
+
+	var (
+		admin   = register("impersonation-admin@example.com")
+		support = register("impersonation-support@example.com")
+		target  = register("impersonation-target@example.com")
+	)
+
+	for _, u := range []*auth.User{admin, support} {
+		if err := svc.Groups().AddUser(u.ID, groups[0].ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// users without the permission can not impersonate
+	if _, err := svc.Impersonate(login(target, time.Hour), admin.ID); !errors.Is(err, auth.ErrForbidden) {
+		t.Fatalf("expected forbidden without permission got %v", err)
+	}
+
+	adminSess := login(admin, time.Hour*2)
+
+	// users who can impersonate can not be impersonated
+	if _, err := svc.Impersonate(adminSess, support.ID); !errors.Is(err, auth.ErrForbidden) {
+		t.Fatalf("expected forbidden for impersonating target got %v", err)
+	}
+
+	sess, err := svc.Impersonate(adminSess, target.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sess.IsImpersonated() || sess.User.ID != target.ID || sess.Impersonator.ID != admin.ID {
+		t.Fatalf("unexpected impersonated session %+v", sess)
+	}
+
+	if sess.ExpiresAt.After(time.Now().Add(auth.ImpersonationDuration)) {
+		t.Fatalf("expected lifetime to be capped at %s got %s", auth.ImpersonationDuration, sess.ExpiresAt)
+	}
+
+	// impersonated sessions do not outlive the admin session
+	shortSess := login(admin, time.Minute)
+	short, err := svc.Impersonate(shortSess, target.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if short.ExpiresAt.After(shortSess.ExpiresAt) {
+		t.Fatalf("expected expiry of the admin session %s got %s", shortSess.ExpiresAt, short.ExpiresAt)
+	}
+
+	if _, err := svc.Impersonate(sess, admin.ID); !errors.Is(err, auth.ErrForbidden) {
+		t.Fatalf("expected impersonated sessions not to impersonate got %v", err)
+	}
+
+	original, err := svc.StopImpersonation(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if original.ID != adminSess.ID {
+		t.Fatalf("expected admin session %s got %s", adminSess.ID, original.ID)
+	}
+
+	if _, err := svc.Sessions().ByID(sess.ID); !errors.Is(err, auth.ErrSessionNotFound) {
+		t.Fatalf("expected impersonated session to be removed got %v", err)
+	}
+
+	if _, err := svc.StopImpersonation(adminSess); !errors.Is(err, auth.ErrNotImpersonating) {
+		t.Fatalf("expected not impersonating got %v", err)
+	}
+
+	// removing the admin session invalidates the impersonated session
+	if _, err := svc.Sessions().ByID(short.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Sessions().RemoveByID(shortSess.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.Sessions().ByID(short.ID); !errors.Is(err, auth.ErrSessionNotFound) {
+		t.Fatalf("expected impersonated session to be refused got %v", err)
+	}
+}
@@ -0,0 +1,344 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+// InvitationDuration is how long an invitation can be accepted for
+var InvitationDuration = time.Hour * 24 * 7
+
+// Invitation invites a person by email to create an account which joins the given groups
+type Invitation struct {
+	ID         int64
+	InviterID  *int64
+	Email      string
+	Token      string  `db:"-" json:"-"` // only set by Create and Resend, the token is stored hashed
+	TokenHash  string  `json:"-"`
+	GroupIDs   []int64 `db:"-"`
+	Expires    time.Time
+	AcceptedAt *time.Time
+	UserID     *int64 // user created on acceptance
+	RevokedAt  *time.Time
+	CreatedAt  time.Time `db:"created_at,ro"`
+}
+
+func (Invitation) TableName() string {
+	return "invitations"
+}
+
+// IsPending is true when the invitation can still be accepted
+func (inv *Invitation) IsPending() bool {
+	return inv.AcceptedAt == nil && inv.RevokedAt == nil && inv.Expires.After(time.Now())
+}
+
+// InvitationRepo creates and manages invitations
+type InvitationRepo struct {
+	db    orm.DB
+	users *UserRepo
+	actor *Session
+}
+
+// NewInvitationRepo returns an invitation repo sending invitation emails through the mail config of users
+func NewInvitationRepo(db orm.DB, users *UserRepo) *InvitationRepo {
+	return &InvitationRepo{db: db, users: users}
+}
+
+// As returns a copy of the repo whose actions are attributed to the session.
+// The session user is recorded as the inviter.
+func (r *InvitationRepo) As(sess *Session) *InvitationRepo {
+	c := *r
+	c.actor = sess
+	c.users = r.users.As(sess)
+	return &c
+}
+
+// Create invites email to join the groups, revoking any pending invitation for the same email.
+// Returns ErrUserExists if a user with the email already exists.
+// When automatic emails are enabled an invitation email is sent,
+// failures are reported to MailConfig.OnError and do not fail the call.
+func (r *InvitationRepo) Create(email string, groupIDs []int64) (*Invitation, error) {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	tok, err := GenerateToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := Invitation{
+		Email:     email,
+		Token:     tok,
+		TokenHash: hashToken(tok),
+		GroupIDs:  groupIDs,
+		Expires:   time.Now().Add(InvitationDuration),
+	}
+
+	if r.actor != nil {
+		inv.InviterID = r.actor.UserID()
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("select exists (select 1 from users where email = $1)", email).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if exists {
+		return nil, ErrUserExists
+	}
+
+	_, err = tx.Exec("update invitations set revoked_at = now() where email = $1 and accepted_at is null and revoked_at is null", email)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := orm.Add(tx, &inv); err != nil {
+		return nil, err
+	}
+
+	for _, gid := range groupIDs {
+		_, err := tx.Exec("insert into invitation_groups (invitation_id, group_id) values ($1, $2) on conflict do nothing", inv.ID, gid)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	meta := map[string]any{"invitation_id": inv.ID, "email": email, "group_ids": groupIDs}
+	if err := addEvent(tx, EventUserInvited, nil, meta); err != nil {
+		return nil, err
+	}
+
+	if err := r.users.audit.add(tx, NewAuditEntry(r.actor, AuditUserInvited, nil, meta)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	r.send(&inv)
+	return &inv, nil
+}
+
+// ByID returns an invitation along with its groups
+func (r *InvitationRepo) ByID(id int64) (*Invitation, error) {
+	var inv Invitation
+	if err := orm.Get(r.db, &inv, "where id = $1", id); err != nil {
+		if errors.Is(err, orm.ErrNotFound) {
+			return nil, ErrInvitationNotFound
+		}
+
+		return nil, err
+	}
+
+	if err := r.loadGroups(r.db, []*Invitation{&inv}); err != nil {
+		return nil, err
+	}
+
+	return &inv, nil
+}
+
+// Paginate returns the most recent invitations. When pending is true only invitations which can be accepted are returned.
+func (r *InvitationRepo) Paginate(page int, pending bool) ([]Invitation, *orm.PaginationResults, error) {
+	where := ""
+	if pending {
+		where = "where accepted_at is null and revoked_at is null and expires > now()"
+	}
+
+	var invs []Invitation
+	results, err := paginate(r.db, &invs, where, nil, page, PageSize, "id desc")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ptrs := make([]*Invitation, len(invs))
+	for i := range invs {
+		ptrs[i] = &invs[i]
+	}
+
+	if err := r.loadGroups(r.db, ptrs); err != nil {
+		return nil, nil, err
+	}
+
+	return invs, results, nil
+}
+
+// Revoke revokes a pending invitation.
+// Returns ErrInvitationNotFound when the invitation does not exist or is no longer pending.
+func (r *InvitationRepo) Revoke(id int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	res, err := tx.Exec("update invitations set revoked_at = now() where id = $1 and accepted_at is null and revoked_at is null", id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInvitationNotFound
+	}
+
+	if err := r.users.audit.add(tx, NewAuditEntry(r.actor, AuditInvitationRevoked, nil, map[string]any{"invitation_id": id})); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Resend renews the token and expiry of an invitation which has not been accepted or revoked.
+// When automatic emails are enabled the invitation email is sent again,
+// failures are reported to MailConfig.OnError and do not fail the call.
+func (r *InvitationRepo) Resend(id int64) (*Invitation, error) {
+	tok, err := GenerateToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	var inv Invitation
+	cols := orm.Columns(&inv).List()
+	err = orm.QueryRow(r.db, &inv, "update invitations set token_hash = $1, expires = $2 where id = $3 and accepted_at is null and revoked_at is null returning "+cols,
+		hashToken(tok), time.Now().Add(InvitationDuration), id)
+
+	if errors.Is(err, orm.ErrNotFound) {
+		return nil, ErrInvitationNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadGroups(r.db, []*Invitation{&inv}); err != nil {
+		return nil, err
+	}
+
+	inv.Token = tok
+	r.send(&inv)
+	return &inv, nil
+}
+
+// send sends the invitation email, it is a noop when automatic emails are disabled
+func (r *InvitationRepo) send(inv *Invitation) {
+	data := MailData{Token: inv.Token, Until: &inv.Expires}
+	if r.actor != nil && r.actor.User != nil {
+		data.Inviter = r.actor.User.Name
+	}
+
+	r.users.deliver(MailInvitation, "", inv.Email, &data)
+}
+
+// loadGroups sets the group ids of the invitations
+func (r *InvitationRepo) loadGroups(db orm.Querier, invs []*Invitation) error {
+	if len(invs) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Invitation, len(invs))
+	ids := make([]int64, len(invs))
+	for i, inv := range invs {
+		byID[inv.ID] = inv
+		ids[i] = inv.ID
+	}
+
+	rows, err := db.Query("select invitation_id, group_id from invitation_groups where invitation_id = any($1) order by group_id", ids)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var iid, gid int64
+		if err := rows.Scan(&iid, &gid); err != nil {
+			return err
+		}
+
+		byID[iid].GroupIDs = append(byID[iid].GroupIDs, gid)
+	}
+
+	return rows.Err()
+}
+
+// AcceptInvitation creates a confirmed user for the invitation with the given token,
+// adds the user to the invited groups and consumes the invitation in one transaction.
+// The email of the invitation is used regardless of the email in the request.
+// Returns ErrInvitationNotFound when the invitation was accepted or revoked and ErrInvitationExpired when it expired.
+func (s *Service) AcceptInvitation(tok string, req *RegistrationRequest) (*User, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var inv Invitation
+	if err := orm.Get(tx, &inv, "where token_hash = $1 for update", hashToken(tok)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvitationNotFound
+		}
+
+		return nil, err
+	}
+
+	if inv.AcceptedAt != nil || inv.RevokedAt != nil {
+		return nil, ErrInvitationNotFound
+	}
+
+	if inv.Expires.Before(time.Now()) {
+		return nil, ErrInvitationExpired
+	}
+
+	if err := s.invitationRepo.loadGroups(tx, []*Invitation{&inv}); err != nil {
+		return nil, err
+	}
+
+	accepted := *req
+	accepted.Email = inv.Email
+
+	res, err := s.userRepo.register(tx, &accepted, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, gid := range inv.GroupIDs {
+		if err := s.groupRepo.addUser(tx, res.UserID, gid); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec("update invitations set accepted_at = now(), user_id = $1 where id = $2", res.UserID, inv.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := map[string]any{"invitation_id": inv.ID, "email": inv.Email}
+	if err := s.auditRepo.add(tx, NewAuditEntry(nil, AuditInvitationAccepted, &res.UserID, meta)); err != nil {
+		return nil, err
+	}
+
+	var u User
+	if err := orm.Get(tx, &u, "where id = $1", res.UserID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
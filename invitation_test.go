@@ -0,0 +1,141 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cristosal/auth"
+)
+
+func TestInvitationAccept(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	groups := []auth.Group{{Name: "invited_staff", Description: "staff"}, {Name: "invited_sales", Description: "sales"}}
+	t.Cleanup(func() {
+		for _, g := range groups {
+			svc.Groups().Remove(g.ID)
+		}
+	})
+
+	if err := svc.Groups().Seed(groups); err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := svc.Invitations().Create("Invited@Example.com", []int64{groups[0].ID, groups[1].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inv.Token == "" || inv.TokenHash == inv.Token {
+		t.Fatal("expected the token to be returned and stored hashed")
+	}
+
+	u, err := svc.AcceptInvitation(inv.Token, &auth.RegistrationRequest{Name: "Invited", Email: "other@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { svc.EraseUser(u.ID) })
+
+	if u.Email != "invited@example.com" || u.ConfirmedAt == nil {
+		t.Fatalf("expected confirmed user with the invited email got %+v", u)
+	}
+
+	joined, err := svc.Groups().ByUser(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(joined) != 2 {
+		t.Fatalf("expected user in 2 invited groups got %d", len(joined))
+	}
+
+	_, err = svc.AcceptInvitation(inv.Token, &auth.RegistrationRequest{Name: "Again", Password: "password123"})
+	if !errors.Is(err, auth.ErrInvitationNotFound) {
+		t.Fatalf("expected second accept to fail with not found got %v", err)
+	}
+
+	if _, err := svc.Invitations().Create("invited@example.com", nil); !errors.Is(err, auth.ErrUserExists) {
+		t.Fatalf("expected user exists got %v", err)
+	}
+}
+
+func TestInvitationExpired(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	prev := auth.InvitationDuration
+	auth.InvitationDuration = -time.Minute
+	t.Cleanup(func() { auth.InvitationDuration = prev })
+
+	inv, err := svc.Invitations().Create("invite-expired@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { svc.Invitations().Revoke(inv.ID) })
+
+	_, err = svc.AcceptInvitation(inv.Token, &auth.RegistrationRequest{Name: "Expired", Password: "password123"})
+	if !errors.Is(err, auth.ErrInvitationExpired) {
+		t.Fatalf("expected invitation expired got %v", err)
+	}
+}
+
+func TestInvitationRevokedAndReissued(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &auth.RegistrationRequest{Name: "Revoked", Password: "password123"}
+
+	revoked, err := svc.Invitations().Create("invite-revoked@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Invitations().Revoke(revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.AcceptInvitation(revoked.Token, req); !errors.Is(err, auth.ErrInvitationNotFound) {
+		t.Fatalf("expected revoked invitation not to be accepted got %v", err)
+	}
+
+	// creating another invitation for the same email revokes the previous one
+	first, err := svc.Invitations().Create("invite-reissued@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := svc.Invitations().Create("invite-reissued@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { svc.Invitations().Revoke(second.ID) })
+
+	if _, err := svc.AcceptInvitation(first.Token, req); !errors.Is(err, auth.ErrInvitationNotFound) {
+		t.Fatalf("expected reissued invitation not to be accepted got %v", err)
+	}
+
+	// resending replaces the token
+	resent, err := svc.Invitations().Resend(second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.AcceptInvitation(second.Token, req); !errors.Is(err, auth.ErrInvitationNotFound) {
+		t.Fatalf("expected resent token to replace the previous one got %v", err)
+	}
+
+	if resent.Token == "" || resent.Token == second.Token {
+		t.Fatal("expected a new token")
+	}
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+// LoginAttempt records a successful or failed login
+type LoginAttempt struct {
+	ID         int64
+	UserID     *int64
+	Email      string // email or username used to login
+	Success    bool
+	IP         string
+	UserAgent  string
+	DeviceID   string
+	Country    string
+	City       string
+	Latitude   *float64
+	Longitude  *float64
+	NewDevice  bool      // first login from the device while other devices were known
+	Suspicious bool      // location is implausibly far from the previous login
+	CreatedAt  time.Time `db:"created_at,ro"`
+}
+
+func (LoginAttempt) TableName() string {
+	return "login_attempts"
+}
+
+// Device is a device a user has logged in from, identified by the device cookie
+type Device struct {
+	UserID    int64
+	DeviceID  string
+	UserAgent string
+	IP        string
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+func (Device) TableName() string {
+	return "user_devices"
+}
+
+// UseGeoIP enables geolocation of logins for impossible travel detection
+func (r *UserRepo) UseGeoIP(g GeoLocator) {
+	r.geo = g
+}
+
+// LoginHistory returns the most recent login attempts of a user
+func (r *UserRepo) LoginHistory(uid int64, page int) ([]LoginAttempt, *orm.PaginationResults, error) {
+	var attempts []LoginAttempt
+	results, err := paginate(r.db, &attempts, "where user_id = $1", []any{uid}, page, PageSize, "id desc")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return attempts, results, nil
+}
+
+// Devices returns the devices a user has logged in from, most recently used first
+func (r *UserRepo) Devices(uid int64) ([]Device, error) {
+	var devices []Device
+	if err := orm.List(r.db, &devices, "where user_id = $1 order by last_seen desc", uid); err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+// RemoveDevice forgets a device. The next login from it will be considered new
+func (r *UserRepo) RemoveDevice(uid int64, deviceID string) error {
+	return orm.Exec(r.db, "delete from user_devices where user_id = $1 and device_id = $2", uid, deviceID)
+}
+
+// newLoginAttempt returns an attempt with the ip, user agent and device of the repo actor
+func (r *UserRepo) newLoginAttempt(uid *int64, email string, success bool) *LoginAttempt {
+	a := &LoginAttempt{UserID: uid, Email: email, Success: success}
+	if r.actor != nil {
+		a.IP = r.actor.IP
+		a.UserAgent = r.actor.UserAgent
+		a.DeviceID = r.actor.DeviceID
+	}
+
+	if r.geo != nil && a.IP != "" {
+		// geolocation is best effort
+		if loc, err := r.geo.Locate(a.IP); err == nil && loc != nil {
+			a.Country = loc.Country
+			a.City = loc.City
+			a.Latitude = &loc.Latitude
+			a.Longitude = &loc.Longitude
+		}
+	}
+
+	return a
+}
+
+// recordLogin records a successful login for u within tx,
+// detecting new devices and impossible travel and writing events for them.
+func (r *UserRepo) recordLogin(tx *sql.Tx, u *User) (*LoginAttempt, error) {
+	a := r.newLoginAttempt(&u.ID, u.Email, true)
+
+	if a.DeviceID != "" {
+		var known bool
+		row := tx.QueryRow("select exists (select 1 from user_devices where user_id = $1)", u.ID)
+		if err := row.Scan(&known); err != nil {
+			return nil, err
+		}
+
+		var inserted bool
+		row = tx.QueryRow(`insert into user_devices (user_id, device_id, user_agent, ip) values ($1, $2, $3, $4)
+			on conflict (user_id, device_id) do update set last_seen = now(), user_agent = excluded.user_agent, ip = excluded.ip
+			returning (xmax = 0)`, u.ID, a.DeviceID, a.UserAgent, a.IP)
+
+		if err := row.Scan(&inserted); err != nil {
+			return nil, err
+		}
+
+		// the first device of a user is not reported
+		a.NewDevice = inserted && known
+	}
+
+	if a.Latitude != nil {
+		var (
+			prev Location
+			at   time.Time
+			row  = tx.QueryRow(`select latitude, longitude, created_at from login_attempts
+				where user_id = $1 and success and latitude is not null order by id desc limit 1`, u.ID)
+		)
+
+		err := row.Scan(&prev.Latitude, &prev.Longitude, &at)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		cur := Location{Latitude: *a.Latitude, Longitude: *a.Longitude}
+		if err == nil && ImpossibleTravel(&prev, &cur, time.Since(at)) {
+			a.Suspicious = true
+		}
+	}
+
+	if err := orm.Add(tx, a); err != nil {
+		return nil, err
+	}
+
+	if a.NewDevice {
+		payload := map[string]any{"user_id": u.ID, "device_id": a.DeviceID, "ip": a.IP, "user_agent": a.UserAgent}
+		if err := addEvent(tx, EventNewDevice, &u.ID, payload); err != nil {
+			return nil, err
+		}
+	}
+
+	if a.Suspicious {
+		payload := map[string]any{"user_id": u.ID, "ip": a.IP, "country": a.Country, "city": a.City}
+		if err := addEvent(tx, EventImpossibleTravel, &u.ID, payload); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
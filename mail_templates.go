@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	htemplate "html/template"
+	"strings"
+	"sync"
+	ttemplate "text/template"
+	"time"
+)
+
+type MailKind string
+
+const (
+	MailConfirmation  MailKind = "confirmation"
+	MailPasswordReset MailKind = "password_reset"
+	MailEmailChange   MailKind = "email_change"
+	MailNewDevice     MailKind = "new_device"
+	MailLockout       MailKind = "lockout"
+	MailInvitation    MailKind = "invitation"
+)
+
+// MailData is passed to mail templates when rendering
+type MailData struct {
+	AppName   string
+	Locale    string
+	Name      string
+	Email     string
+	NewEmail  string // set for email change notices
+	Token     string
+	URL       string // action link built from the token, if any
+	IP        string
+	UserAgent string
+	Until     *time.Time // end of a lockout or expiry of an invitation
+	Inviter   string     // name of the inviting user for invitations
+	Meta      map[string]any
+}
+
+// Translator translates text for a given locale.
+// It is available within templates as the t function: {{t "Hello %s" .Name}}
+type Translator func(locale, text string) string
+
+// MailTemplates renders the subject, text and html bodies of auth emails.
+// Each kind of email has a default template which can be overridden with Set.
+type MailTemplates struct {
+	mu        sync.RWMutex
+	templates map[MailKind]*mailTemplate
+	translate Translator
+}
+
+type mailTemplate struct {
+	subject *ttemplate.Template
+	text    *ttemplate.Template
+	html    *htemplate.Template
+}
+
+// NewMailTemplates returns the default templates for all kinds of auth emails
+func NewMailTemplates() *MailTemplates {
+	mt := &MailTemplates{templates: make(map[MailKind]*mailTemplate)}
+	for kind, tmpl := range defaultMailTemplates {
+		if err := mt.Set(kind, tmpl[0], tmpl[1], tmpl[2]); err != nil {
+			panic(err)
+		}
+	}
+
+	return mt
+}
+
+// SetTranslator sets the localization hook used by the t template function
+func (mt *MailTemplates) SetTranslator(t Translator) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	mt.translate = t
+}
+
+// Set overrides the templates for a kind of email.
+// Subject and text are text/template strings, html is an html/template string.
+// An empty html template results in text only emails.
+func (mt *MailTemplates) Set(kind MailKind, subject, text, html string) error {
+	var (
+		t   mailTemplate
+		err error
+	)
+
+	// the t func is replaced with a locale aware translator when rendering
+	funcs := map[string]any{"t": func(s string, args ...any) string { return s }}
+
+	if t.subject, err = ttemplate.New("subject").Funcs(funcs).Parse(subject); err != nil {
+		return fmt.Errorf("error parsing %s subject: %w", kind, err)
+	}
+
+	if t.text, err = ttemplate.New("text").Funcs(funcs).Parse(text); err != nil {
+		return fmt.Errorf("error parsing %s text: %w", kind, err)
+	}
+
+	if html != "" {
+		if t.html, err = htemplate.New("html").Funcs(funcs).Parse(html); err != nil {
+			return fmt.Errorf("error parsing %s html: %w", kind, err)
+		}
+	}
+
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	mt.templates[kind] = &t
+	return nil
+}
+
+// Render executes the templates for a kind of email returning the resulting mail.
+// The From and To fields are left empty.
+func (mt *MailTemplates) Render(kind MailKind, data *MailData) (*Mail, error) {
+	mt.mu.RLock()
+	t, ok := mt.templates[kind]
+	translate := mt.translate
+	mt.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no mail template for %s", kind)
+	}
+
+	funcs := map[string]any{
+		"t": func(s string, args ...any) string {
+			if translate != nil {
+				s = translate(data.Locale, s)
+			}
+
+			if len(args) > 0 {
+				s = fmt.Sprintf(s, args...)
+			}
+
+			return s
+		},
+	}
+
+	var (
+		m   Mail
+		buf bytes.Buffer
+	)
+
+	subject, err := t.subject.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := subject.Funcs(funcs).Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	m.Subject = strings.TrimSpace(buf.String())
+	buf.Reset()
+
+	text, err := t.text.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := text.Funcs(funcs).Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	m.Text = buf.String()
+	buf.Reset()
+
+	if t.html != nil {
+		html, err := t.html.Clone()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := html.Funcs(funcs).Execute(&buf, data); err != nil {
+			return nil, err
+		}
+
+		m.HTML = buf.String()
+	}
+
+	return &m, nil
+}
+
+// defaultMailTemplates are subject, text and html templates by kind
+var defaultMailTemplates = map[MailKind][3]string{
+	MailConfirmation: {
+		`{{t "Confirm your %s account" .AppName}}`,
+		`{{t "Hi %s," .Name}}
+
+{{t "Please confirm your email address to finish creating your account."}}
+{{if .URL}}
+{{.URL}}
+{{else}}
+{{t "Your confirmation code is %s" .Token}}
+{{end}}
+{{t "If you did not create an account you can ignore this email."}}
+`,
+		`<p>{{t "Hi %s," .Name}}</p>
+<p>{{t "Please confirm your email address to finish creating your account."}}</p>
+{{if .URL}}<p><a href="{{.URL}}">{{t "Confirm email"}}</a></p>{{else}}<p>{{t "Your confirmation code is %s" .Token}}</p>{{end}}
+<p>{{t "If you did not create an account you can ignore this email."}}</p>
+`,
+	},
+	MailPasswordReset: {
+		`{{t "Reset your %s password" .AppName}}`,
+		`{{t "Hi %s," .Name}}
+
+{{t "We received a request to reset your password."}}
+{{if .URL}}
+{{.URL}}
+{{else}}
+{{t "Your password reset code is %s" .Token}}
+{{end}}
+{{t "If you did not request a password reset you can ignore this email."}}
+`,
+		`<p>{{t "Hi %s," .Name}}</p>
+<p>{{t "We received a request to reset your password."}}</p>
+{{if .URL}}<p><a href="{{.URL}}">{{t "Reset password"}}</a></p>{{else}}<p>{{t "Your password reset code is %s" .Token}}</p>{{end}}
+<p>{{t "If you did not request a password reset you can ignore this email."}}</p>
+`,
+	},
+	MailEmailChange: {
+		`{{t "Your %s email address was changed" .AppName}}`,
+		`{{t "Hi %s," .Name}}
+
+{{t "The email address on your account was changed to %s." .NewEmail}}
+
+{{t "If you did not make this change please contact support immediately."}}
+`,
+		`<p>{{t "Hi %s," .Name}}</p>
+<p>{{t "The email address on your account was changed to %s." .NewEmail}}</p>
+<p>{{t "If you did not make this change please contact support immediately."}}</p>
+`,
+	},
+	MailNewDevice: {
+		`{{t "New sign-in to your %s account" .AppName}}`,
+		`{{t "Hi %s," .Name}}
+
+{{t "Your account was signed in to from a new device."}}
+
+{{if .IP}}{{t "IP address: %s" .IP}}
+{{end}}{{if .UserAgent}}{{t "Device: %s" .UserAgent}}
+{{end}}
+{{t "If this was not you please reset your password."}}
+`,
+		`<p>{{t "Hi %s," .Name}}</p>
+<p>{{t "Your account was signed in to from a new device."}}</p>
+<ul>
+{{if .IP}}<li>{{t "IP address: %s" .IP}}</li>{{end}}
+{{if .UserAgent}}<li>{{t "Device: %s" .UserAgent}}</li>{{end}}
+</ul>
+<p>{{t "If this was not you please reset your password."}}</p>
+`,
+	},
+	MailLockout: {
+		`{{t "Your %s account has been locked" .AppName}}`,
+		`{{t "Hi %s," .Name}}
+
+{{t "Your account was temporarily locked after too many failed sign-in attempts."}}
+{{if .Until}}
+{{t "You can try again after %s." (.Until.Format "2006-01-02 15:04 MST")}}
+{{end}}
+{{t "If this was not you please reset your password."}}
+`,
+		`<p>{{t "Hi %s," .Name}}</p>
+<p>{{t "Your account was temporarily locked after too many failed sign-in attempts."}}</p>
+{{if .Until}}<p>{{t "You can try again after %s." (.Until.Format "2006-01-02 15:04 MST")}}</p>{{end}}
+<p>{{t "If this was not you please reset your password."}}</p>
+`,
+	},
+	MailInvitation: {
+		`{{t "You have been invited to %s" .AppName}}`,
+		`{{t "Hi,"}}
+
+{{if .Inviter}}{{t "%s has invited you to join %s." .Inviter .AppName}}{{else}}{{t "You have been invited to join %s." .AppName}}{{end}}
+{{if .URL}}
+{{.URL}}
+{{else}}
+{{t "Your invitation code is %s" .Token}}
+{{end}}
+{{if .Until}}{{t "This invitation expires on %s." (.Until.Format "2006-01-02")}}{{end}}
+`,
+		`<p>{{t "Hi,"}}</p>
+<p>{{if .Inviter}}{{t "%s has invited you to join %s." .Inviter .AppName}}{{else}}{{t "You have been invited to join %s." .AppName}}{{end}}</p>
+{{if .URL}}<p><a href="{{.URL}}">{{t "Accept invitation"}}</a></p>{{else}}<p>{{t "Your invitation code is %s" .Token}}</p>{{end}}
+{{if .Until}}<p>{{t "This invitation expires on %s." (.Until.Format "2006-01-02")}}</p>{{end}}
+`,
+	},
+}
@@ -0,0 +1,98 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cristosal/auth"
+)
+
+func TestMailTemplatesRender(t *testing.T) {
+	tmpl := auth.NewMailTemplates()
+	m, err := tmpl.Render(auth.MailConfirmation, &auth.MailData{
+		AppName: "Acme",
+		Name:    "<pepe>",
+		URL:     "https://acme.test/confirm?token=abc",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Subject != "Confirm your Acme account" {
+		t.Fatalf("unexpected subject %q", m.Subject)
+	}
+
+	if !strings.Contains(m.Text, "https://acme.test/confirm?token=abc") {
+		t.Fatal("expected text to contain url")
+	}
+
+	if !strings.Contains(m.HTML, "&lt;pepe&gt;") {
+		t.Fatal("expected html to be escaped")
+	}
+}
+
+func TestMailTemplatesTranslate(t *testing.T) {
+	tmpl := auth.NewMailTemplates()
+	tmpl.SetTranslator(func(locale, text string) string {
+		if locale == "es" && text == "Reset your %s password" {
+			return "Restablece tu contraseña de %s"
+		}
+		return text
+	})
+
+	m, err := tmpl.Render(auth.MailPasswordReset, &auth.MailData{AppName: "Acme", Locale: "es"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Subject != "Restablece tu contraseña de Acme" {
+		t.Fatalf("unexpected subject %q", m.Subject)
+	}
+}
+
+func TestMailTemplatesOverride(t *testing.T) {
+	tmpl := auth.NewMailTemplates()
+	if err := tmpl.Set(auth.MailLockout, "Locked", "Bye {{.Name}}", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := tmpl.Render(auth.MailLockout, &auth.MailData{Name: "pepe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Text != "Bye pepe" || m.HTML != "" {
+		t.Fatalf("unexpected mail %+v", m)
+	}
+
+	mailer := auth.NewMemoryMailer()
+	if err := mailer.Send(m); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mailer.Messages()) != 1 {
+		t.Fatal("expected message to be stored")
+	}
+}
+
+func TestMailTemplatesInvitation(t *testing.T) {
+	tmpl := auth.NewMailTemplates()
+	m, err := tmpl.Render(auth.MailInvitation, &auth.MailData{
+		AppName: "Acme",
+		Inviter: "Pepe",
+		Token:   "abc",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Subject != "You have been invited to Acme" {
+		t.Fatalf("unexpected subject %q", m.Subject)
+	}
+
+	if !strings.Contains(m.Text, "Pepe has invited you to join Acme.") || !strings.Contains(m.Text, "abc") {
+		t.Fatalf("unexpected text %q", m.Text)
+	}
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Mail is an email message with optional text and html bodies
+type Mail struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Bytes returns the mail encoded as a MIME message
+func (m *Mail) Bytes() ([]byte, error) {
+	var (
+		buf = new(bytes.Buffer)
+		mw  = multipart.NewWriter(buf)
+	)
+
+	fmt.Fprintf(buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(buf, "To: %s\r\n", m.To)
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+
+	parts := [][2]string{{"text/plain", m.Text}, {"text/html", m.HTML}}
+	for _, part := range parts {
+		if part[1] == "" {
+			continue
+		}
+
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part[0] + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		qw := quotedprintable.NewWriter(w)
+		if _, err := qw.Write([]byte(part[1])); err != nil {
+			return nil, err
+		}
+
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Mailer is the interface implemented by email transports
+type Mailer interface {
+	Send(m *Mail) error
+}
+
+// SMTPMailer sends mail through an smtp server
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer returns a mailer which sends mail through the smtp server at addr (host:port)
+func NewSMTPMailer(addr string, auth smtp.Auth) *SMTPMailer {
+	return &SMTPMailer{addr, auth}
+}
+
+// Send is the implementation of the Mailer interface
+func (s *SMTPMailer) Send(m *Mail) error {
+	msg, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(s.addr, s.auth, m.From, []string{m.To}, msg)
+}
+
+// DirMailer is a maildrop which writes every message as an .eml file to a directory.
+// Useful for local development.
+type DirMailer struct{ dir string }
+
+// NewDirMailer returns a mailer writing messages to dir, creating it if necessary
+func NewDirMailer(dir string) (*DirMailer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &DirMailer{dir}, nil
+}
+
+// Send is the implementation of the Mailer interface
+func (d *DirMailer) Send(m *Mail) error {
+	msg, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+
+	suffix, err := GenerateToken(4)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), suffix)
+	return os.WriteFile(filepath.Join(d.dir, name), msg, 0600)
+}
+
+// MemoryMailer keeps sent messages in memory. Useful for testing.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Mail
+}
+
+// NewMemoryMailer returns an empty in-memory mailer
+func NewMemoryMailer() *MemoryMailer {
+	return new(MemoryMailer)
+}
+
+// Send is the implementation of the Mailer interface
+func (mm *MemoryMailer) Send(m *Mail) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	mm.messages = append(mm.messages, *m)
+	return nil
+}
+
+// Messages returns a copy of all sent messages
+func (mm *MemoryMailer) Messages() []Mail {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	return append([]Mail(nil), mm.messages...)
+}
+
+// Reset clears all sent messages
+func (mm *MemoryMailer) Reset() {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	mm.messages = nil
+}
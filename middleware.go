@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// SessionCookieName is the cookie holding the session id read by SessionRepo.Middleware
+	SessionCookieName = "auth_session"
+
+	// SecureCookies restricts the session and device cookies to https.
+	// Disable it only for local development over plain http.
+	SecureCookies = true
+)
+
+type sessionContextKey struct{}
+
+// WithSession returns a copy of the context carrying the session
+func WithSession(ctx context.Context, sess *Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, sess)
+}
+
+// SessionFromContext returns the session of the context or nil when there is none
+func SessionFromContext(ctx context.Context) *Session {
+	sess, _ := ctx.Value(sessionContextKey{}).(*Session)
+	return sess
+}
+
+// SetSessionCookie stores the session id in the session cookie until the session expires
+func SetSessionCookie(w http.ResponseWriter, sess *Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    sess.ID,
+		Path:     "/",
+		Expires:  sess.ExpiresAt,
+		MaxAge:   int(time.Until(sess.ExpiresAt).Seconds()),
+		HttpOnly: true,
+		Secure:   SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearSessionCookie removes the session cookie
+func ClearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: SessionCookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, Secure: SecureCookies})
+}
+
+// Middleware loads the session of the session cookie into the request context, see SessionFromContext.
+// Requests with a missing or expired session, or whose user may not login, continue without a session.
+func (s *SessionRepo) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie(SessionCookieName)
+		if err != nil || c.Value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sess, err := s.ByID(c.Value)
+		switch {
+		case err == nil && !sess.Expired():
+			r = r.WithContext(WithSession(r.Context(), sess))
+		case err == nil, errors.Is(err, ErrSessionNotFound), errors.Is(err, ErrUserSuspended),
+			errors.Is(err, ErrUserDisabled), errors.Is(err, ErrUserDeleted):
+			// continue without a session
+		default:
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Guard protects handlers by the session of the request, see SessionRepo.Middleware.
+// The zero value responds with json error bodies.
+type Guard struct {
+	// LoginURL redirects requests without an authorized session to login with the return url,
+	// a json 401 is sent when empty
+	LoginURL string
+
+	// ReturnParam is the query parameter of the login url holding the return url, defaults to "return_to"
+	ReturnParam string
+
+	// ForbiddenURL redirects requests lacking a permission or group, a json 403 is sent when empty
+	ForbiddenURL string
+}
+
+// DefaultGuard is used by RequireAuth, RequirePermission, RequirePermissionValue and RequireGroup
+var DefaultGuard = &Guard{}
+
+// RequireAuth responds with 401 unless the request has an authorized session, see DefaultGuard
+func RequireAuth(next http.Handler) http.Handler {
+	return DefaultGuard.RequireAuth(next)
+}
+
+// RequirePermission responds with 403 unless the session has the permission, see DefaultGuard
+func RequirePermission(name string) func(http.Handler) http.Handler {
+	return DefaultGuard.RequirePermission(name)
+}
+
+// RequirePermissionValue responds with 403 unless the value of the permission is at least min, see DefaultGuard
+func RequirePermissionValue(name string, min int) func(http.Handler) http.Handler {
+	return DefaultGuard.RequirePermissionValue(name, min)
+}
+
+// RequireGroup responds with 403 unless the session user is part of the group, see DefaultGuard
+func RequireGroup(name string) func(http.Handler) http.Handler {
+	return DefaultGuard.RequireGroup(name)
+}
+
+// RequireAuth responds with 401 unless the request has an authorized session which has not expired
+func (g *Guard) RequireAuth(next http.Handler) http.Handler {
+	return g.require(func(*Session) bool { return true })(next)
+}
+
+// RequirePermission responds with 401 without an authorized session and 403 unless the session has the permission
+func (g *Guard) RequirePermission(name string) func(http.Handler) http.Handler {
+	return g.require(func(sess *Session) bool {
+		return sess.Permissions.Has(name)
+	})
+}
+
+// RequirePermissionValue responds with 401 without an authorized session
+// and 403 unless the value of the permission is at least min
+func (g *Guard) RequirePermissionValue(name string, min int) func(http.Handler) http.Handler {
+	return g.require(func(sess *Session) bool {
+		return sess.Permissions.Has(name) && sess.Permissions.Value(name) >= min
+	})
+}
+
+// RequireGroup responds with 401 without an authorized session and 403 unless the session user is part of the group
+func (g *Guard) RequireGroup(name string) func(http.Handler) http.Handler {
+	return g.require(func(sess *Session) bool {
+		for i := range sess.Groups {
+			if sess.Groups[i].Name == name {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+func (g *Guard) require(allowed func(*Session) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sess := SessionFromContext(r.Context())
+			if sess == nil || !sess.IsAuthorized() || sess.Expired() {
+				g.unauthorized(w, r)
+				return
+			}
+
+			if !allowed(sess) {
+				g.forbidden(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (g *Guard) unauthorized(w http.ResponseWriter, r *http.Request) {
+	if g.LoginURL == "" || wantsJSON(r) {
+		writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+		return
+	}
+
+	param := g.ReturnParam
+	if param == "" {
+		param = "return_to"
+	}
+
+	u, err := url.Parse(g.LoginURL)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+		return
+	}
+
+	q := u.Query()
+	q.Set(param, r.URL.RequestURI())
+	u.RawQuery = q.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+}
+
+func (g *Guard) forbidden(w http.ResponseWriter, r *http.Request) {
+	if g.ForbiddenURL == "" || wantsJSON(r) {
+		writeError(w, http.StatusForbidden, ErrForbidden)
+		return
+	}
+
+	http.Redirect(w, r, g.ForbiddenURL, http.StatusSeeOther)
+}
+
+// wantsJSON is true for requests which accept json but not html, such as api calls
+func wantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,103 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cristosal/auth"
+)
+
+func TestGuard(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	sess := &auth.Session{
+		User:        &auth.User{ID: 1},
+		ExpiresAt:   time.Now().Add(time.Hour),
+		Groups:      auth.Groups{{Name: "staff"}},
+		Permissions: auth.GroupPermissions{{Name: "upload", Value: 10}},
+	}
+
+	expired := *sess
+	expired.ExpiresAt = time.Now().Add(-time.Hour)
+
+	var (
+		jsonGuard     = &auth.Guard{}
+		redirectGuard = &auth.Guard{LoginURL: "/login?next=1", ForbiddenURL: "/forbidden"}
+	)
+
+	tt := []struct {
+		name     string
+		handler  http.Handler
+		sess     *auth.Session
+		accept   string
+		status   int
+		location string
+	}{
+		{"auth anonymous", jsonGuard.RequireAuth(ok), nil, "", http.StatusUnauthorized, ""},
+		{"auth expired", jsonGuard.RequireAuth(ok), &expired, "", http.StatusUnauthorized, ""},
+		{"auth", jsonGuard.RequireAuth(ok), sess, "", http.StatusNoContent, ""},
+		{"permission", jsonGuard.RequirePermission("upload")(ok), sess, "", http.StatusNoContent, ""},
+		{"permission missing", jsonGuard.RequirePermission("delete")(ok), sess, "", http.StatusForbidden, ""},
+		{"permission anonymous", jsonGuard.RequirePermission("upload")(ok), nil, "", http.StatusUnauthorized, ""},
+		{"permission value", jsonGuard.RequirePermissionValue("upload", 10)(ok), sess, "", http.StatusNoContent, ""},
+		{"permission value low", jsonGuard.RequirePermissionValue("upload", 11)(ok), sess, "", http.StatusForbidden, ""},
+		{"group", jsonGuard.RequireGroup("staff")(ok), sess, "", http.StatusNoContent, ""},
+		{"group missing", jsonGuard.RequireGroup("admins")(ok), sess, "", http.StatusForbidden, ""},
+		{"redirect login", redirectGuard.RequireAuth(ok), nil, "text/html", http.StatusSeeOther, "/login?next=1&return_to=%2Fadmin%3Fpage%3D2"},
+		{"redirect forbidden", redirectGuard.RequireGroup("admins")(ok), sess, "text/html", http.StatusSeeOther, "/forbidden"},
+		{"redirect guard json", redirectGuard.RequireAuth(ok), nil, "application/json", http.StatusUnauthorized, ""},
+	}
+
+	for _, tc := range tt {
+		r := httptest.NewRequest(http.MethodGet, "/admin?page=2", nil)
+		r.Header.Set("Accept", tc.accept)
+		if tc.sess != nil {
+			r = r.WithContext(auth.WithSession(r.Context(), tc.sess))
+		}
+
+		w := httptest.NewRecorder()
+		tc.handler.ServeHTTP(w, r)
+
+		if w.Code != tc.status {
+			t.Fatalf("%s: expected status %d got %d", tc.name, tc.status, w.Code)
+		}
+
+		if loc := w.Header().Get("Location"); loc != tc.location {
+			t.Fatalf("%s: expected location %q got %q", tc.name, tc.location, loc)
+		}
+
+		if tc.location == "" && w.Code >= 400 {
+			var body map[string]string
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body["error"] == "" {
+				t.Fatalf("%s: expected json error body got %v", tc.name, err)
+			}
+		}
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	sess := &auth.Session{ID: "abc", ExpiresAt: time.Now().Add(time.Hour)}
+
+	w := httptest.NewRecorder()
+	auth.SetSessionCookie(w, sess)
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != sess.ID || !cookies[0].Secure || !cookies[0].HttpOnly {
+		t.Fatalf("expected secure session cookie got %+v", cookies)
+	}
+
+	auth.SecureCookies = false
+	t.Cleanup(func() { auth.SecureCookies = true })
+
+	w = httptest.NewRecorder()
+	auth.SetSessionCookie(w, sess)
+
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Secure {
+		t.Fatalf("expected insecure session cookie got %+v", cookies)
+	}
+}
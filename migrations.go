@@ -105,4 +105,347 @@ var migrations = []orm.Migration{
 			);`,
 		Down: "DROP TABLE group_users",
 	},
+	{
+		Name:        "users phone confirmed at",
+		Description: "add phone_confirmed_at column to users table",
+		Up:          `alter table users add column if not exists phone_confirmed_at timestamptz;`,
+		Down:        "ALTER TABLE users DROP COLUMN phone_confirmed_at",
+	},
+	{
+		Name:        "phone codes table",
+		Description: "create phone codes table",
+		Up: `create table if not exists phone_codes (
+				user_id int not null references users (id) on delete cascade,
+				purpose varchar(32) not null,
+				phone varchar(255) not null,
+				code varchar(16) not null,
+				attempts int not null default 0,
+				expires timestamptz not null,
+				primary key (user_id, purpose)
+			);`,
+		Down: "DROP TABLE phone_codes",
+	},
+	{
+		Name:        "auth events table",
+		Description: "create auth events outbox table",
+		Up: `create table if not exists auth_events (
+				id bigserial primary key,
+				type varchar(255) not null,
+				user_id int,
+				payload jsonb not null,
+				attempts int not null default 0,
+				last_error text not null default '',
+				created_at timestamptz not null default now(),
+				next_attempt_at timestamptz not null default now(),
+				delivered_at timestamptz
+			);
+			create index if not exists auth_events_pending_idx on auth_events (next_attempt_at) where delivered_at is null;`,
+		Down: "DROP TABLE auth_events",
+	},
+	{
+		Name:        "webhooks table",
+		Description: "create webhooks table",
+		Up: `create table if not exists webhooks (
+				id serial primary key,
+				url text not null,
+				secret varchar(255) not null,
+				event_type varchar(255) not null default '*',
+				active boolean not null default true,
+				created_at timestamptz not null default now()
+			);`,
+		Down: "DROP TABLE webhooks",
+	},
+	{
+		Name:        "webhook deliveries table",
+		Description: "create webhook deliveries table",
+		Up: `create table if not exists webhook_deliveries (
+				id bigserial primary key,
+				webhook_id int not null references webhooks (id) on delete cascade,
+				event_id bigint references auth_events (id) on delete set null,
+				event_type varchar(255) not null,
+				payload jsonb not null,
+				status varchar(16) not null default 'pending',
+				attempts int not null default 0,
+				response_status int not null default 0,
+				last_error text not null default '',
+				next_attempt_at timestamptz not null default now(),
+				created_at timestamptz not null default now(),
+				delivered_at timestamptz,
+				unique (webhook_id, event_id)
+			);
+			create index if not exists webhook_deliveries_pending_idx on webhook_deliveries (next_attempt_at) where status = 'pending';`,
+		Down: "DROP TABLE webhook_deliveries",
+	},
+	{
+		Name:        "audit log table",
+		Description: "create audit log table",
+		Up: `create table if not exists audit_log (
+				id bigserial primary key,
+				actor_id int,
+				target_id int,
+				action varchar(255) not null,
+				ip varchar(64) not null default '',
+				user_agent text not null default '',
+				metadata jsonb not null default '{}',
+				prev_hash varchar(64) not null default '',
+				hash varchar(64) not null default '',
+				created_at timestamptz not null default now()
+			);
+			create index if not exists audit_log_actor_idx on audit_log (actor_id, created_at);
+			create index if not exists audit_log_target_idx on audit_log (target_id, created_at);
+			create index if not exists audit_log_action_idx on audit_log (action, created_at);`,
+		Down: "DROP TABLE audit_log",
+	},
+	{
+		Name:        "login attempts table",
+		Description: "create login attempts table",
+		Up: `create table if not exists login_attempts (
+				id bigserial primary key,
+				user_id int references users (id) on delete cascade,
+				email varchar(1024) not null,
+				success boolean not null,
+				ip varchar(64) not null default '',
+				user_agent text not null default '',
+				device_id varchar(64) not null default '',
+				country varchar(2) not null default '',
+				city varchar(255) not null default '',
+				latitude double precision,
+				longitude double precision,
+				new_device boolean not null default false,
+				suspicious boolean not null default false,
+				created_at timestamptz not null default now()
+			);
+			create index if not exists login_attempts_user_idx on login_attempts (user_id, id);`,
+		Down: "DROP TABLE login_attempts",
+	},
+	{
+		Name:        "user devices table",
+		Description: "create user devices table",
+		Up: `create table if not exists user_devices (
+				user_id int not null references users (id) on delete cascade,
+				device_id varchar(64) not null,
+				user_agent text not null default '',
+				ip varchar(64) not null default '',
+				first_seen timestamptz not null default now(),
+				last_seen timestamptz not null default now(),
+				primary key (user_id, device_id)
+			);`,
+		Down: "DROP TABLE user_devices",
+	},
+	{
+		Name:        "users status",
+		Description: "add status columns to users table",
+		Up: `alter table users
+				add column if not exists status varchar(16) not null default 'active',
+				add column if not exists status_reason text not null default '',
+				add column if not exists suspended_until timestamptz,
+				add column if not exists deleted_at timestamptz,
+				add column if not exists anonymized_at timestamptz;
+			create index if not exists users_deleted_idx on users (deleted_at) where status = 'deleted';`,
+		Down: `ALTER TABLE users
+				DROP COLUMN status,
+				DROP COLUMN status_reason,
+				DROP COLUMN suspended_until,
+				DROP COLUMN deleted_at,
+				DROP COLUMN anonymized_at`,
+	},
+	{
+		Name:        "sessions cascade",
+		Description: "delete sessions along with their user",
+		Up: `alter table sessions drop constraint if exists sessions_user_id_fkey;
+			alter table sessions add constraint sessions_user_id_fkey foreign key (user_id) references users (id) on delete cascade;`,
+		Down: `ALTER TABLE sessions DROP CONSTRAINT sessions_user_id_fkey;
+			ALTER TABLE sessions ADD CONSTRAINT sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id);`,
+	},
+	{
+		Name:        "audit log redaction",
+		Description: "add redacted_at column to audit log",
+		Up:          `alter table audit_log add column if not exists redacted_at timestamptz;`,
+		Down:        "ALTER TABLE audit_log DROP COLUMN redacted_at",
+	},
+	{
+		Name:        "users attributes",
+		Description: "add custom attributes column to users table",
+		Up: `alter table users add column if not exists attributes jsonb not null default '{}';
+			create index if not exists users_attributes_idx on users using gin (attributes jsonb_path_ops);`,
+		Down: `DROP INDEX IF EXISTS users_attributes_idx;
+			ALTER TABLE users DROP COLUMN attributes`,
+	},
+	{
+		Name:        "users username",
+		Description: "add optional case insensitive unique username to users table",
+		Up: `alter table users add column if not exists username varchar(64) not null default '';
+			create unique index if not exists users_username_idx on users (lower(username)) where username <> '';`,
+		Down: `DROP INDEX IF EXISTS users_username_idx;
+			ALTER TABLE users DROP COLUMN username`,
+	},
+	{
+		Name:        "users email citext",
+		Description: "add canonical email for duplicate detection, emails are made case insensitive by Service.Init",
+		Up: `create extension if not exists citext;
+			alter table users add column if not exists email_canonical varchar(1024) not null default '';
+			create index if not exists users_email_canonical_idx on users (email_canonical);`,
+		Down: `DROP INDEX IF EXISTS users_email_canonical_idx;
+			ALTER TABLE users DROP COLUMN email_canonical;
+			ALTER TABLE users ALTER COLUMN email TYPE varchar(1024);`,
+	},
+	{
+		Name:        "users search indexes",
+		Description: "add indexes for keyset pagination of users",
+		Up: `create index if not exists users_created_at_id_idx on users (created_at, id);
+			create index if not exists users_last_login_id_idx on users ((coalesce(last_login, '0001-01-01 00:00:00+00')), id);
+			create index if not exists users_name_id_idx on users (name, id);
+			create index if not exists users_email_id_idx on users (email, id);`,
+		Down: `DROP INDEX IF EXISTS users_created_at_id_idx;
+			DROP INDEX IF EXISTS users_last_login_id_idx;
+			DROP INDEX IF EXISTS users_name_id_idx;
+			DROP INDEX IF EXISTS users_email_id_idx;`,
+	},
+	{
+		Name:        "invitations table",
+		Description: "create invitations table",
+		Up: `create table if not exists invitations (
+				id serial primary key,
+				inviter_id int references users (id) on delete set null,
+				email citext not null,
+				token_hash varchar(64) not null unique,
+				expires timestamptz not null,
+				accepted_at timestamptz,
+				user_id int references users (id) on delete set null,
+				revoked_at timestamptz,
+				created_at timestamptz not null default now()
+			);
+			create index if not exists invitations_email_idx on invitations (email);`,
+		Down: "DROP TABLE invitations",
+	},
+	{
+		Name:        "invitation groups table",
+		Description: "create invitation groups table",
+		Up: `create table if not exists invitation_groups (
+				invitation_id int not null references invitations (id) on delete cascade,
+				group_id int not null references groups (id) on delete cascade,
+				primary key (invitation_id, group_id)
+			);`,
+		Down: "DROP TABLE invitation_groups",
+	},
+	{
+		Name:        "groups parent",
+		Description: "add parent_id column to groups table",
+		Up: `alter table groups add column if not exists parent_id int references groups (id) on delete set null;
+			create index if not exists groups_parent_id_idx on groups (parent_id);`,
+		Down: `DROP INDEX IF EXISTS groups_parent_id_idx;
+			ALTER TABLE groups DROP COLUMN IF EXISTS parent_id;`,
+	},
+	{
+		Name:        "user permissions table",
+		Description: "create user permissions table",
+		Up: `create table if not exists user_permissions (
+				user_id int not null references users (id) on delete cascade,
+				permission_id int not null references permissions (id) on delete cascade,
+				value int not null default 0,
+				deny boolean not null default false,
+				expires_at timestamptz,
+				created_at timestamptz not null default now(),
+				primary key (user_id, permission_id)
+			);`,
+		Down: "DROP TABLE user_permissions",
+	},
+	{
+		Name:        "group permissions deny",
+		Description: "add deny column to group permissions table",
+		Up:          "alter table group_permissions add column if not exists deny boolean not null default false",
+		Down:        "ALTER TABLE group_permissions DROP COLUMN IF EXISTS deny",
+	},
+	{
+		Name:        "acl entries table",
+		Description: "create acl entries table",
+		Up: `create table if not exists acl_entries (
+				id serial primary key,
+				permission_id int not null references permissions (id) on delete cascade,
+				resource_type varchar(255) not null,
+				resource_id varchar(255) not null,
+				user_id int references users (id) on delete cascade,
+				group_id int references groups (id) on delete cascade,
+				created_at timestamptz not null default now(),
+				check ((user_id is null) <> (group_id is null))
+			);
+			create unique index if not exists acl_entries_user_idx on acl_entries (user_id, permission_id, resource_type, resource_id) where user_id is not null;
+			create unique index if not exists acl_entries_group_idx on acl_entries (group_id, permission_id, resource_type, resource_id) where group_id is not null;
+			create index if not exists acl_entries_resource_idx on acl_entries (resource_type, resource_id);`,
+		Down: "DROP TABLE acl_entries",
+	},
+	{
+		Name:        "relation tuples table",
+		Description: "create relation tuples table",
+		Up: `create table if not exists relation_tuples (
+				object_type varchar(255) not null,
+				object_id varchar(255) not null,
+				relation varchar(255) not null,
+				subject_type varchar(255) not null,
+				subject_id varchar(255) not null,
+				subject_relation varchar(255) not null default '',
+				created_at timestamptz not null default now(),
+				primary key (object_type, object_id, relation, subject_type, subject_id, subject_relation)
+			);
+			create index if not exists relation_tuples_subject_idx on relation_tuples (subject_type, subject_id, subject_relation);`,
+		Down: "DROP TABLE relation_tuples",
+	},
+	{
+		Name:        "policies table",
+		Description: "create policies table",
+		Up: `create table if not exists policies (
+				id serial primary key,
+				name varchar(255) not null,
+				description text not null default '',
+				action varchar(255) not null,
+				resource_type varchar(255) not null default '',
+				effect varchar(16) not null check (effect in ('allow', 'deny')),
+				condition text not null default '',
+				created_at timestamptz not null default now()
+			);
+			create index if not exists policies_action_idx on policies (action);`,
+		Down: "DROP TABLE policies",
+	},
+	{
+		Name:        "quota usage table",
+		Description: "create quota usage table",
+		Up: `create table if not exists quota_usage (
+				user_id int not null references users (id) on delete cascade,
+				permission_id int not null references permissions (id) on delete cascade,
+				window_start timestamptz not null,
+				resets_at timestamptz,
+				used int not null default 0 check (used >= 0),
+				updated_at timestamptz not null default now(),
+				primary key (user_id, permission_id, window_start)
+			);
+			create index if not exists quota_usage_resets_at_idx on quota_usage (resets_at);`,
+		Down: "DROP TABLE quota_usage",
+	},
+	{
+		Name:        "phone code hashes",
+		Description: "store phone codes hashed, codes sent before are discarded",
+		Up: `delete from phone_codes;
+			alter table phone_codes rename column code to code_hash;
+			alter table phone_codes alter column code_hash type varchar(64);`,
+		Down: `delete from phone_codes;
+			alter table phone_codes alter column code_hash type varchar(16);
+			alter table phone_codes rename column code_hash to code;`,
+	},
+	{
+		Name:        "users email case insensitive",
+		Description: "make emails case insensitive unless emails differing only in case exist, see UserRepo.MakeEmailsCaseInsensitive",
+		Up: `do $$
+			begin
+				if not exists (select 1 from users group by lower(email) having count(*) > 1) then
+					alter table users alter column email type citext;
+				end if;
+			end $$;`,
+		Down: "alter table users alter column email type varchar(1024)",
+	},
+	{
+		Name:        "permissions quota window",
+		Description: "add the quota window of permissions",
+		Up:          "alter table permissions add column if not exists quota_window varchar(16) not null default ''",
+		Down:        "alter table permissions drop column if exists quota_window",
+	},
 }
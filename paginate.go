@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/cristosal/orm"
+)
+
+// paginate is like orm.Paginate but filters rows with an sql where clause and its arguments.
+// orm.Paginate only accepts an order by clause, counting and listing every row of the table,
+// so filtered listings such as user search and the audit log can not use it.
+// Pages start at 0 and results have the same meaning as orm.PaginationResults.
+func paginate[T any](db orm.Querier, v *[]T, where string, args []any, page, size int, orderBy string) (*orm.PaginationResults, error) {
+	var t T
+	count, err := orm.Count(db, &t, where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := page * size
+	sql := fmt.Sprintf("%s order by %s limit %d offset %d", where, orderBy, size, offset)
+	if err := orm.List(db, v, sql, args...); err != nil {
+		return nil, err
+	}
+
+	end := (page + 1) * size
+	if int64(end) > count {
+		end = int(count)
+	}
+
+	return &orm.PaginationResults{
+		Total:   count,
+		Page:    page,
+		Start:   offset + 1,
+		End:     end,
+		HasNext: int64(offset+size) < count,
+	}, nil
+}
@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// RehashPasswords replaces password hashes which are not bcrypt with PasswordHashCost on successful login.
+// Hashes of imported users are upgraded this way.
+var RehashPasswords = true
+
+// Limits on the cost parameters of imported hashes, verifying hashes above them would exhaust the server.
+const (
+	maxArgon2Memory    = 1 << 20 // KiB
+	maxArgon2Time      = 10
+	maxArgon2Threads   = 255
+	maxPBKDF2Iteration = 10_000_000
+)
+
+// IsPasswordHash reports whether hash is in a format that can be verified.
+// Supported formats are bcrypt ($2a$, $2b$, $2y$), argon2 in PHC format ($argon2id$, $argon2i$),
+// PBKDF2 in django format (pbkdf2_sha256$) and passlib format ($pbkdf2-sha256$).
+// Hashes with an argon2 memory above 1 GiB, time above 10 or parallelism above 255,
+// or with more than 10 million PBKDF2 iterations are not supported.
+func IsPasswordHash(hash string) bool {
+	_, err := hashVerifier(hash)
+	return err == nil
+}
+
+func verifyHash(hash string, pass string) error {
+	verify, err := hashVerifier(hash)
+	if err != nil {
+		return err
+	}
+
+	return verify(pass)
+}
+
+// needsRehash reports whether the hash should be replaced with one from PasswordHash
+func needsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < PasswordHashCost
+}
+
+// hashVerifier parses the hash returning a function which verifies a password against it
+func hashVerifier(hash string) (func(pass string) error, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, ErrUnsupportedHash
+		}
+
+		return func(pass string) error {
+			return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass))
+		}, nil
+	case strings.HasPrefix(hash, "$argon2"):
+		return argon2Verifier(hash)
+	case strings.HasPrefix(hash, "pbkdf2_"):
+		return djangoPBKDF2Verifier(hash)
+	case strings.HasPrefix(hash, "$pbkdf2"):
+		return passlibPBKDF2Verifier(hash)
+	}
+
+	return nil, ErrUnsupportedHash
+}
+
+// argon2Verifier parses $argon2id$v=19$m=65536,t=3,p=4$salt$hash
+func argon2Verifier(hash string) (func(string) error, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[2] != "v=19" {
+		return nil, ErrUnsupportedHash
+	}
+
+	var (
+		memory  uint32
+		time    uint32
+		threads uint8
+	)
+
+	for _, param := range strings.Split(parts[3], ",") {
+		k, v, _ := strings.Cut(param, "=")
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, ErrUnsupportedHash
+		}
+
+		switch k {
+		case "m":
+			if n > maxArgon2Memory {
+				return nil, ErrUnsupportedHash
+			}
+
+			memory = uint32(n)
+		case "t":
+			if n > maxArgon2Time {
+				return nil, ErrUnsupportedHash
+			}
+
+			time = uint32(n)
+		case "p":
+			if n > maxArgon2Threads {
+				return nil, ErrUnsupportedHash
+			}
+
+			threads = uint8(n)
+		}
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, ErrUnsupportedHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || memory == 0 || time == 0 || threads == 0 {
+		return nil, ErrUnsupportedHash
+	}
+
+	var derive func(pass, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte
+	switch parts[1] {
+	case "argon2id":
+		derive = argon2.IDKey
+	case "argon2i":
+		derive = argon2.Key
+	default:
+		return nil, ErrUnsupportedHash
+	}
+
+	return func(pass string) error {
+		return compareKeys(key, derive([]byte(pass), salt, time, memory, threads, uint32(len(key))))
+	}, nil
+}
+
+// djangoPBKDF2Verifier parses pbkdf2_sha256$iterations$salt$hash
+func djangoPBKDF2Verifier(hash string) (func(string) error, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 {
+		return nil, ErrUnsupportedHash
+	}
+
+	h := pbkdf2Hash(strings.TrimPrefix(parts[0], "pbkdf2_"))
+	iter, err := strconv.Atoi(parts[1])
+	if h == nil || err != nil || iter <= 0 || iter > maxPBKDF2Iteration {
+		return nil, ErrUnsupportedHash
+	}
+
+	key, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, ErrUnsupportedHash
+	}
+
+	salt := []byte(parts[2])
+	return func(pass string) error {
+		return compareKeys(key, pbkdf2.Key([]byte(pass), salt, iter, len(key), h))
+	}, nil
+}
+
+// passlibPBKDF2Verifier parses $pbkdf2-sha256$rounds$salt$hash using passlib's adapted base64
+func passlibPBKDF2Verifier(hash string) (func(string) error, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 {
+		return nil, ErrUnsupportedHash
+	}
+
+	name := strings.TrimPrefix(parts[1], "pbkdf2")
+	name = strings.TrimPrefix(name, "-")
+	if name == "" {
+		name = "sha1"
+	}
+
+	h := pbkdf2Hash(name)
+	iter, err := strconv.Atoi(parts[2])
+	if h == nil || err != nil || iter <= 0 || iter > maxPBKDF2Iteration {
+		return nil, ErrUnsupportedHash
+	}
+
+	ab64 := strings.NewReplacer(".", "+")
+	salt, err := base64.RawStdEncoding.DecodeString(ab64.Replace(parts[3]))
+	if err != nil {
+		return nil, ErrUnsupportedHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(ab64.Replace(parts[4]))
+	if err != nil {
+		return nil, ErrUnsupportedHash
+	}
+
+	return func(pass string) error {
+		return compareKeys(key, pbkdf2.Key([]byte(pass), salt, iter, len(key), h))
+	}, nil
+}
+
+func pbkdf2Hash(name string) func() hash.Hash {
+	switch name {
+	case "sha1":
+		return sha1.New
+	case "sha256":
+		return sha256.New
+	case "sha512":
+		return sha512.New
+	}
+
+	return nil
+}
+
+func compareKeys(expected, actual []byte) error {
+	if subtle.ConstantTimeCompare(expected, actual) != 1 {
+		return ErrUnauthorized
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package auth_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/cristosal/auth"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerifyPasswordHashes(t *testing.T) {
+	bc, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+
+	salt := []byte("somesaltsomesalt")
+	key := argon2.IDKey([]byte("secret"), salt, 1, 64*1024, 2, 32)
+	a2 := fmt.Sprintf("$argon2id$v=19$m=65536,t=1,p=2$%s$%s",
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+	hashes := []string{
+		string(bc),
+		a2,
+		"pbkdf2_sha256$1000$saltsalt$hgR9HsqtKupWxpnv8y99TrPDajTT/9PcSTlNafpdLXQ=",
+		"$pbkdf2-sha512$2000$AQIDBAUGBwgJEA$lGU4xERQ81d/bDNETEtpU/0AQHfCh7yKmUNu4Fc4rrLqZrzGAAR1aS0SOoyiArqi7kNEN2cO6j0qkG1o8XxmKQ",
+	}
+
+	for _, h := range hashes {
+		if !auth.IsPasswordHash(h) {
+			t.Fatalf("expected %s to be supported", h)
+		}
+
+		u := auth.User{Password: h}
+		if !u.VerifyPassword("secret") {
+			t.Fatalf("expected password to match %s", h)
+		}
+
+		if u.VerifyPassword("wrong") {
+			t.Fatalf("expected wrong password not to match %s", h)
+		}
+	}
+
+	for _, h := range []string{"", "secret", "md5$abc", "$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5", "pbkdf2_md5$1000$salt$aGFzaA=="} {
+		if auth.IsPasswordHash(h) {
+			t.Fatalf("expected %q not to be supported", h)
+		}
+	}
+}
+
+func TestPasswordHashLimits(t *testing.T) {
+	hashes := []string{
+		"$argon2id$v=19$m=4294967295,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=1048577,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=65536,t=11,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=65536,t=1,p=256$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=65536,t=1,p=257$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5",
+		"pbkdf2_sha256$10000001$saltsalt$hgR9HsqtKupWxpnv8y99TrPDajTT/9PcSTlNafpdLXQ=",
+		"$pbkdf2-sha512$2147483647$AQIDBAUGBwgJEA$lGU4xERQ81d/bDNETEtpU/0AQHfCh7yKmUNu4Fc4rrLqZrzGAAR1aS0SOoyiArqi7kNEN2cO6j0qkG1o8XxmKQ",
+	}
+
+	for _, h := range hashes {
+		if auth.IsPasswordHash(h) {
+			t.Fatalf("expected %q to exceed the limits", h)
+		}
+
+		u := auth.User{Password: h}
+		if u.VerifyPassword("secret") {
+			t.Fatalf("expected %q not to verify", h)
+		}
+	}
+
+	for _, h := range []string{
+		"$argon2id$v=19$m=1048576,t=10,p=255$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5",
+		"pbkdf2_sha256$10000000$saltsalt$hgR9HsqtKupWxpnv8y99TrPDajTT/9PcSTlNafpdLXQ=",
+	} {
+		if !auth.IsPasswordHash(h) {
+			t.Fatalf("expected %q to be within the limits", h)
+		}
+	}
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/cristosal/orm"
 )
 
-type PermissionType = string
+type PermissionType string
 
 const (
 	Quantity PermissionType = "quantity"
@@ -22,6 +22,7 @@ type Permission struct {
 	Name        string
 	Description string
 	Type        PermissionType
+	QuotaWindow QuotaWindow // reset window of quantity permissions, see QuotaRepo
 }
 
 func (p *Permission) TableName() string {
@@ -55,12 +56,12 @@ func (r *PermissionRepo) Seed(permissions []Permission) error {
 	)
 
 	for _, v := range permissions {
-		parts = append(parts, fmt.Sprintf("($%d, $%d, $%d)", i, i+1, i+2))
-		args = append(args, v.Name, v.Description, v.Type)
-		i += 3
+		parts = append(parts, fmt.Sprintf("($%d, $%d, $%d, $%d)", i, i+1, i+2, i+3))
+		args = append(args, v.Name, v.Description, v.Type, v.QuotaWindow)
+		i += 4
 	}
 
-	sql := fmt.Sprintf("insert into permissions (name, description, type) values %s on conflict (name) do nothing",
+	sql := fmt.Sprintf("insert into permissions (name, description, type, quota_window) values %s on conflict (name) do nothing",
 		strings.Join(parts, ", "))
 
 	if err := orm.Exec(r.db, sql, args...); err != nil {
@@ -0,0 +1,108 @@
+package auth
+
+import "sort"
+
+// PermissionStrategy resolves conflicting group entries of a single permission.
+// Entries are sorted by SortPermissions and the strategy returns the winning entry, pointing into entries,
+// along with the resolved value. A winning entry which denies the permission denies it to the user.
+type PermissionStrategy func(entries GroupPermissions) (*GroupPermission, int)
+
+// SortPermissions sorts entries so that conflicts resolve the same way regardless of the order they were loaded in.
+// Direct entries come first, then entries of groups with higher priority, denials before grants
+// and finally entries of groups with lower ids.
+func SortPermissions(gps GroupPermissions) {
+	sort.SliceStable(gps, func(i, j int) bool {
+		a, b := &gps[i], &gps[j]
+		switch {
+		case a.Direct != b.Direct:
+			return a.Direct
+		case a.Priority != b.Priority:
+			return a.Priority > b.Priority
+		case a.Deny != b.Deny:
+			return a.Deny
+		default:
+			return a.GroupID < b.GroupID
+		}
+	})
+}
+
+// StrategyPriority resolves to the entry of the group with the highest priority, whether it grants or denies.
+// This is the default strategy.
+func StrategyPriority(entries GroupPermissions) (*GroupPermission, int) {
+	if len(entries) == 0 {
+		return nil, 0
+	}
+
+	return &entries[0], entries[0].Value
+}
+
+// StrategyDenyOverrides denies the permission when any group denies it,
+// otherwise the entry of the group with the highest priority wins.
+func StrategyDenyOverrides(entries GroupPermissions) (*GroupPermission, int) {
+	if deny := firstDeny(entries); deny != nil {
+		return deny, 0
+	}
+
+	return StrategyPriority(entries)
+}
+
+// StrategyMax denies the permission when any group denies it, otherwise the entry with the highest value wins
+func StrategyMax(entries GroupPermissions) (*GroupPermission, int) {
+	return strategyCompare(entries, func(a, b int) bool { return a > b })
+}
+
+// StrategyMin denies the permission when any group denies it, otherwise the entry with the lowest value wins
+func StrategyMin(entries GroupPermissions) (*GroupPermission, int) {
+	return strategyCompare(entries, func(a, b int) bool { return a < b })
+}
+
+// StrategySum denies the permission when any group denies it.
+// The values of Quantity permissions are added up with the entry of the highest priority group as the winner.
+// Other permissions are resolved by StrategyPriority.
+func StrategySum(entries GroupPermissions) (*GroupPermission, int) {
+	if deny := firstDeny(entries); deny != nil {
+		return deny, 0
+	}
+
+	winner, value := StrategyPriority(entries)
+	if winner == nil || winner.Type != Quantity {
+		return winner, value
+	}
+
+	value = 0
+	for i := range entries {
+		value += entries[i].Value
+	}
+
+	return winner, value
+}
+
+// strategyCompare returns the first entry whose value is better than all the ones before it
+func strategyCompare(entries GroupPermissions, better func(a, b int) bool) (*GroupPermission, int) {
+	if deny := firstDeny(entries); deny != nil {
+		return deny, 0
+	}
+
+	var winner *GroupPermission
+	for i := range entries {
+		if winner == nil || better(entries[i].Value, winner.Value) {
+			winner = &entries[i]
+		}
+	}
+
+	if winner == nil {
+		return nil, 0
+	}
+
+	return winner, winner.Value
+}
+
+func firstDeny(entries GroupPermissions) *GroupPermission {
+	for i := range entries {
+		if entries[i].Deny {
+			return &entries[i]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"strings"
+)
+
+// NormalizePhone returns the phone number in E.164 format (+14155550100).
+// Spaces, dashes, dots, slashes and parentheses are ignored and the number must start with + or 00.
+// Returns ErrInvalidPhone if the number can not be normalized.
+func NormalizePhone(phone string) (string, error) {
+	return NormalizePhoneWithCountry(phone, "")
+}
+
+// NormalizePhoneWithCountry normalizes the phone number as NormalizePhone does,
+// prepending the country code to numbers which are not in international format.
+func NormalizePhoneWithCountry(phone, countryCode string) (string, error) {
+	var b strings.Builder
+	for _, c := range strings.TrimSpace(phone) {
+		switch {
+		case c >= '0' && c <= '9', c == '+':
+			b.WriteRune(c)
+		case c == ' ', c == '-', c == '.', c == '/', c == '(', c == ')':
+			continue
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	digits := b.String()
+
+	switch {
+	case strings.HasPrefix(digits, "+"):
+		digits = digits[1:]
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	case countryCode != "":
+		digits = strings.TrimPrefix(countryCode, "+") + strings.TrimLeft(digits, "0")
+	default:
+		return "", ErrInvalidPhone
+	}
+
+	// E.164 allows at most 15 digits and country codes never start with 0
+	if len(digits) < 7 || len(digits) > 15 || digits[0] == '0' || strings.Contains(digits, "+") {
+		return "", ErrInvalidPhone
+	}
+
+	return "+" + digits, nil
+}
@@ -0,0 +1,45 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cristosal/auth"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tt := [][]string{
+		{"+1 (415) 555-0100", "+14155550100"},
+		{"0044 20 7946 0958", "+442079460958"},
+		{" +34.612.345.678 ", "+34612345678"},
+	}
+
+	for _, tc := range tt {
+		phone, err := auth.NormalizePhone(tc[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if phone != tc[1] {
+			t.Fatalf("expected %s got %s", tc[1], phone)
+		}
+	}
+
+	invalid := []string{"hello world", "4155550100", "+0123456789", "+1234", "+1234567890123456", "+1 415 555 0100 ext 2"}
+	for _, phone := range invalid {
+		if _, err := auth.NormalizePhone(phone); !errors.Is(err, auth.ErrInvalidPhone) {
+			t.Fatalf("expected invalid phone for %q got %v", phone, err)
+		}
+	}
+}
+
+func TestNormalizePhoneWithCountry(t *testing.T) {
+	phone, err := auth.NormalizePhoneWithCountry("020 7946 0958", "44")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if phone != "+442079460958" {
+		t.Fatalf("expected +442079460958 got %s", phone)
+	}
+}
@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+const (
+	PhoneCodeLength        = 6
+	PhoneCodeDuration      = time.Minute * 10
+	PhoneCodeMaxAttempts   = 5  // wrong guesses before a code is discarded
+	PhoneCodeWindowGuesses = 10 // wrong guesses across all codes within PhoneCodeResendWindow
+	PhoneCodeResendMax     = 3  // codes that can be sent within PhoneCodeResendWindow
+	PhoneCodeResendWindow  = time.Hour
+)
+
+type PhoneCodePurpose string
+
+const (
+	PhoneVerification PhoneCodePurpose = "verify"
+	PhoneLogin        PhoneCodePurpose = "login"
+)
+
+// PhoneCode is a one time code sent to a users phone
+type PhoneCode struct {
+	UserID   int64
+	Purpose  PhoneCodePurpose
+	Phone    string
+	CodeHash string // sha256 of the code, see hashToken
+	Attempts int
+	Expires  time.Time
+}
+
+func (PhoneCode) TableName() string {
+	return "phone_codes"
+}
+
+// PhoneVerifier sends and checks one time codes over sms.
+// It is used for verifying phone numbers and as a second factor during login.
+type PhoneVerifier struct {
+	db      orm.DB
+	sender  SMSSender
+	limiter Limiter
+}
+
+// NewPhoneVerifier returns a phone verifier sending codes through sender.
+// Code resends and wrong guesses are rate limited by limiter.
+// If limiter is nil a MemoryLimiter is used, which only limits within the process.
+func NewPhoneVerifier(db orm.DB, sender SMSSender, limiter Limiter) *PhoneVerifier {
+	if limiter == nil {
+		limiter = NewMemoryLimiter()
+	}
+
+	return &PhoneVerifier{
+		db:      db,
+		sender:  sender,
+		limiter: limiter,
+	}
+}
+
+// RequestVerification sends a verification code to the users phone.
+// Returns ErrLimitReached when too many codes have been requested within PhoneCodeResendWindow.
+func (v *PhoneVerifier) RequestVerification(uid int64) error {
+	u, err := v.user(uid)
+	if err != nil {
+		return err
+	}
+
+	return v.send(u, PhoneVerification, "Your verification code is %s")
+}
+
+// ConfirmVerification checks the code sent by RequestVerification and marks the users phone as confirmed
+func (v *PhoneVerifier) ConfirmVerification(uid int64, code string) (*User, error) {
+	var u User
+	err := v.check(uid, PhoneVerification, code, func(tx *sql.Tx, pc *PhoneCode) error {
+		cols := orm.Columns(&u).List()
+		sql := fmt.Sprintf("update users set phone_confirmed_at = now() where id = $1 and phone = $2 returning %s", cols)
+		err := orm.QueryRow(tx, &u, sql, uid, pc.Phone)
+		if errors.Is(err, orm.ErrNotFound) {
+			// phone number changed after the code was sent
+			return ErrInvalidCode
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+// SendLoginCode sends a one time login code to the users confirmed phone.
+// It is meant to be used as a second factor after a successful Authenticate.
+func (v *PhoneVerifier) SendLoginCode(uid int64) error {
+	u, err := v.user(uid)
+	if err != nil {
+		return err
+	}
+
+	if !u.IsPhoneConfirmed() {
+		return ErrPhoneNotConfirmed
+	}
+
+	return v.send(u, PhoneLogin, "Your login code is %s")
+}
+
+// VerifyLoginCode checks the code sent by SendLoginCode
+func (v *PhoneVerifier) VerifyLoginCode(uid int64, code string) error {
+	return v.check(uid, PhoneLogin, code, nil)
+}
+
+func (v *PhoneVerifier) user(uid int64) (*User, error) {
+	var u User
+	if err := orm.Get(v.db, &u, "where id = $1", uid); err != nil {
+		if errors.Is(err, orm.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+
+		return nil, err
+	}
+
+	if u.Phone == "" {
+		return nil, ErrPhoneRequired
+	}
+
+	return &u, nil
+}
+
+func (v *PhoneVerifier) send(u *User, purpose PhoneCodePurpose, msg string) error {
+	if v.sender == nil {
+		return ErrNoSMSSender
+	}
+
+	key := fmt.Sprintf("phone_code:%s:%d", purpose, u.ID)
+	if err := v.limiter.Limit(key, PhoneCodeResendMax, PhoneCodeResendWindow); err != nil {
+		return err
+	}
+
+	code, err := generateCode(PhoneCodeLength)
+	if err != nil {
+		return err
+	}
+
+	// a new code always replaces the previous one, wrong guesses are still limited across codes, see check
+	err = orm.Exec(v.db, `insert into phone_codes (user_id, purpose, phone, code_hash, attempts, expires) values ($1, $2, $3, $4, 0, $5)
+		on conflict (user_id, purpose) do update set phone = excluded.phone, code_hash = excluded.code_hash, attempts = 0, expires = excluded.expires`,
+		u.ID, purpose, u.Phone, hashToken(code), time.Now().Add(PhoneCodeDuration))
+
+	if err != nil {
+		return err
+	}
+
+	return v.sender.SendSMS(u.Phone, fmt.Sprintf(msg, code))
+}
+
+// check verifies the code and consumes it on success, calling fn within the same transaction.
+// Failed attempts are counted and the code is discarded after PhoneCodeMaxAttempts.
+// Returns ErrLimitReached after PhoneCodeWindowGuesses wrong guesses within PhoneCodeResendWindow, regardless of resends.
+func (v *PhoneVerifier) check(uid int64, purpose PhoneCodePurpose, code string, fn func(tx *sql.Tx, pc *PhoneCode) error) error {
+	guesses := fmt.Sprintf("phone_guess:%s:%d", purpose, uid)
+	if v.limiter.TTL(guesses, PhoneCodeWindowGuesses) > 0 {
+		return ErrLimitReached
+	}
+
+	tx, err := v.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var pc PhoneCode
+	if err := orm.Get(tx, &pc, "where user_id = $1 and purpose = $2 for update", uid, purpose); err != nil {
+		if errors.Is(err, orm.ErrNotFound) {
+			return ErrTokenNotFound
+		}
+
+		return err
+	}
+
+	if pc.Expires.Before(time.Now()) {
+		return ErrTokenExpired
+	}
+
+	if subtle.ConstantTimeCompare([]byte(pc.CodeHash), []byte(hashToken(code))) != 1 {
+		if err := v.limiter.Limit(guesses, PhoneCodeWindowGuesses, PhoneCodeResendWindow); err != nil && !errors.Is(err, ErrLimitReached) {
+			return err
+		}
+
+		sql := "update phone_codes set attempts = attempts + 1 where user_id = $1 and purpose = $2"
+		if pc.Attempts+1 >= PhoneCodeMaxAttempts {
+			sql = "delete from phone_codes where user_id = $1 and purpose = $2"
+		}
+
+		if err := orm.Exec(tx, sql, uid, purpose); err != nil {
+			return err
+		}
+
+		// failed attempts are persisted
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		return ErrInvalidCode
+	}
+
+	if err := orm.Exec(tx, "delete from phone_codes where user_id = $1 and purpose = $2", uid, purpose); err != nil {
+		return err
+	}
+
+	if fn != nil {
+		if err := fn(tx, &pc); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// generateCode returns a random numeric code of n digits
+func generateCode(n int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+	num, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", n, num.Int64()), nil
+}
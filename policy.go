@@ -0,0 +1,433 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+type PolicyEffect string
+
+const (
+	PolicyAllow PolicyEffect = "allow"
+	PolicyDeny  PolicyEffect = "deny"
+)
+
+// Policy allows or denies an action when its condition holds, see Expression for the condition syntax.
+// Conditions are evaluated with the variables user, resource and env, see PolicyRequest.
+type Policy struct {
+	ID           int64
+	Name         string
+	Description  string
+	Action       string // action the policy applies to such as "refund"
+	ResourceType string // resource type the policy applies to, empty applies to all
+	Effect       PolicyEffect
+	Condition    string    // empty always holds
+	CreatedAt    time.Time `db:"created_at,ro"`
+
+	expr *Expression `db:"-"` // compiled condition, see expression
+}
+
+func (*Policy) TableName() string {
+	return "policies"
+}
+
+// Compile validates the policy and compiles its condition.
+// Returns ErrInvalidPolicy when the effect is unknown or the condition does not parse.
+func (p *Policy) Compile() (*Expression, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	return CompileExpression(p.condition())
+}
+
+func (p *Policy) validate() error {
+	if p.Action == "" {
+		return fmt.Errorf("%w: action is required", ErrInvalidPolicy)
+	}
+
+	if p.Effect != PolicyAllow && p.Effect != PolicyDeny {
+		return fmt.Errorf("%w: unknown effect %q", ErrInvalidPolicy, p.Effect)
+	}
+
+	return nil
+}
+
+// condition returns the source the condition is compiled from
+func (p *Policy) condition() string {
+	if cond := strings.TrimSpace(p.Condition); cond != "" {
+		return cond
+	}
+
+	return "true"
+}
+
+// expression validates the policy and returns its compiled condition.
+// The condition is compiled once and compiled again only when it changes.
+func (p *Policy) expression() (*Expression, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	if p.expr != nil && p.expr.source == p.condition() {
+		return p.expr, nil
+	}
+
+	expr, err := CompileExpression(p.condition())
+	if err != nil {
+		return nil, err
+	}
+
+	p.expr = expr
+	return expr, nil
+}
+
+// applies is true when the policy applies to the action on the resource type
+func (p *Policy) applies(action, resourceType string) bool {
+	return p.Action == action && (p.ResourceType == "" || p.ResourceType == resourceType)
+}
+
+// PolicyRequest asks whether a user may perform an action on a resource
+type PolicyRequest struct {
+	Session      *Session // sets User, user.groups, user.permissions and env.ip when present
+	User         *User
+	Action       string
+	ResourceType string
+	Resource     Attributes     // available as resource
+	Env          map[string]any // available as env along with env.time and env.ip unless set
+}
+
+// Vars returns the variables conditions are evaluated with.
+// The user variable holds the user attributes along with id, name, username, email, status and confirmed.
+func (req *PolicyRequest) Vars() map[string]any {
+	var (
+		user = make(map[string]any)
+		env  = map[string]any{"time": time.Now()}
+		u    = req.User
+	)
+
+	if req.Session != nil {
+		if u == nil {
+			u = req.Session.User
+		}
+
+		env["ip"] = req.Session.IP
+
+		groups := make([]any, len(req.Session.Groups))
+		for i := range req.Session.Groups {
+			groups[i] = req.Session.Groups[i].Name
+		}
+
+		perms := make([]any, 0, len(req.Session.Permissions))
+		for i := range req.Session.Permissions {
+			if name := req.Session.Permissions[i].Name; req.Session.Permissions.Has(name) {
+				perms = append(perms, name)
+			}
+		}
+
+		user["groups"] = groups
+		user["permissions"] = perms
+	}
+
+	if u != nil {
+		for k, v := range u.Attributes {
+			user[k] = v
+		}
+
+		user["id"] = u.ID
+		user["name"] = u.Name
+		user["username"] = u.Username
+		user["email"] = u.Email
+		user["status"] = u.Status
+		user["confirmed"] = u.IsConfirmed()
+	}
+
+	for k, v := range req.Env {
+		env[k] = v
+	}
+
+	resource := map[string]any(req.Resource)
+	if resource == nil {
+		resource = make(map[string]any)
+	}
+
+	return map[string]any{"user": user, "resource": resource, "env": env}
+}
+
+// PolicyError is a policy which could not be evaluated.
+// Allow policies which can not be evaluated do not hold, deny policies deny the request.
+type PolicyError struct {
+	Policy *Policy
+	Err    error
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("policy %s: %v", e.Policy.Name, e.Err)
+}
+
+func (e *PolicyError) Unwrap() error {
+	return e.Err
+}
+
+// PolicyDecision is the result of evaluating policies
+type PolicyDecision struct {
+	Allowed bool
+	Policy  *Policy       // policy which decided, nil when no policy applied and the request was denied by default
+	Errors  []PolicyError // policies which failed to evaluate
+}
+
+// EvaluatePolicies decides whether the request is allowed by the policies.
+// A deny policy whose condition holds overrides allow policies and requests are denied when no allow policy holds.
+// Policies whose condition fails to evaluate are reported in the decision.
+// A deny policy failing to evaluate denies the request, an allow policy failing to evaluate does not hold.
+// Conditions are compiled once per policy, see Policy.Compile.
+func EvaluatePolicies(policies []Policy, req *PolicyRequest) (*PolicyDecision, error) {
+	var (
+		d    PolicyDecision
+		vars = req.Vars()
+	)
+
+	for i := range policies {
+		p := &policies[i]
+		if !p.applies(req.Action, req.ResourceType) {
+			continue
+		}
+
+		expr, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+
+		holds, err := expr.EvalBool(vars)
+		if err != nil {
+			d.Errors = append(d.Errors, PolicyError{Policy: p, Err: err})
+
+			// deny policies fail closed
+			holds = p.Effect == PolicyDeny
+		}
+
+		if !holds {
+			continue
+		}
+
+		if p.Effect == PolicyDeny {
+			d.Allowed = false
+			d.Policy = p
+			return &d, nil
+		}
+
+		if !d.Allowed {
+			d.Allowed = true
+			d.Policy = p
+		}
+	}
+
+	return &d, nil
+}
+
+// PolicyTest is a case for RunPolicyTests
+type PolicyTest struct {
+	Name     string
+	Request  PolicyRequest
+	Expected bool
+}
+
+// RunPolicyTests evaluates each test against the policies without a database.
+// Returns an error describing every test whose decision differs from the expected one or whose policies fail to evaluate.
+func RunPolicyTests(policies []Policy, tests []PolicyTest) error {
+	var errs []error
+	for i := range tests {
+		tc := &tests[i]
+		d, err := EvaluatePolicies(policies, &tc.Request)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tc.Name, err))
+			continue
+		}
+
+		for j := range d.Errors {
+			errs = append(errs, fmt.Errorf("%s: %w", tc.Name, &d.Errors[j]))
+		}
+
+		if d.Allowed != tc.Expected {
+			errs = append(errs, fmt.Errorf("%s: expected allowed to be %v", tc.Name, tc.Expected))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// PolicyRepo stores policies and evaluates requests against them
+type PolicyRepo struct {
+	db    orm.DB
+	audit *AuditRepo
+	actor *Session
+	exprs *policyExpressions
+}
+
+func NewPolicyRepo(db orm.DB) *PolicyRepo {
+	return &PolicyRepo{db: db, exprs: &policyExpressions{exprs: make(map[int64]*Expression)}}
+}
+
+// policyExpressions holds the compiled conditions of stored policies by policy id
+type policyExpressions struct {
+	mu    sync.Mutex
+	exprs map[int64]*Expression
+}
+
+// attach sets the compiled conditions of the policies, compiling the conditions which are new or changed.
+// Policies which fail to compile are left for EvaluatePolicies to report.
+func (c *policyExpressions) attach(policies []Policy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range policies {
+		p := &policies[i]
+		p.expr = c.exprs[p.ID]
+
+		if expr, err := p.expression(); err == nil {
+			c.exprs[p.ID] = expr
+		}
+	}
+}
+
+// store holds the compiled condition of a policy which was written
+func (c *policyExpressions) store(p *Policy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.exprs[p.ID] = p.expr
+}
+
+func (c *policyExpressions) remove(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.exprs, id)
+}
+
+// As returns a copy of the repo whose actions are attributed to the session in the audit log
+func (r *PolicyRepo) As(sess *Session) *PolicyRepo {
+	c := *r
+	c.actor = sess
+	return &c
+}
+
+// Add validates and adds a policy, see Policy.Compile
+func (r *PolicyRepo) Add(p *Policy) error {
+	if _, err := p.expression(); err != nil {
+		return err
+	}
+
+	err := r.write(AuditPolicyAdded, p, func(tx orm.QuerierExecuter) error {
+		return orm.Add(tx, p)
+	})
+
+	if err == nil {
+		r.exprs.store(p)
+	}
+
+	return err
+}
+
+// Update validates and updates a policy, see Policy.Compile
+func (r *PolicyRepo) Update(p *Policy) error {
+	if _, err := p.expression(); err != nil {
+		return err
+	}
+
+	err := r.write(AuditPolicyUpdated, p, func(tx orm.QuerierExecuter) error {
+		return orm.UpdateByID(tx, p)
+	})
+
+	if err == nil {
+		r.exprs.store(p)
+	}
+
+	return err
+}
+
+// Remove deletes a policy by id.
+// Returns ErrPolicyNotFound when the policy does not exist.
+func (r *PolicyRepo) Remove(id int64) error {
+	err := r.write(AuditPolicyRemoved, &Policy{ID: id}, func(tx orm.QuerierExecuter) error {
+		res, err := tx.Exec("delete from policies where id = $1", id)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrPolicyNotFound
+		}
+
+		return nil
+	})
+
+	if err == nil {
+		r.exprs.remove(id)
+	}
+
+	return err
+}
+
+func (r *PolicyRepo) write(action AuditAction, p *Policy, fn func(orm.QuerierExecuter) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	meta := map[string]any{"policy_id": p.ID, "name": p.Name, "action": p.Action, "effect": p.Effect, "condition": p.Condition}
+	if err := r.audit.add(tx, NewAuditEntry(r.actor, action, nil, meta)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ByID returns a policy by id
+func (r *PolicyRepo) ByID(id int64) (*Policy, error) {
+	var p Policy
+	if err := orm.Get(r.db, &p, "where id = $1", id); err != nil {
+		if errors.Is(err, orm.ErrNotFound) {
+			return nil, ErrPolicyNotFound
+		}
+
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// List returns all policies ordered by action and name
+func (r *PolicyRepo) List() ([]Policy, error) {
+	var policies []Policy
+	if err := orm.List(r.db, &policies, "order by action, name, id"); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// Evaluate decides whether the request is allowed by the stored policies of its action, see EvaluatePolicies
+func (r *PolicyRepo) Evaluate(req *PolicyRequest) (*PolicyDecision, error) {
+	var policies []Policy
+	err := orm.List(r.db, &policies, "where action = $1 and (resource_type = '' or resource_type = $2) order by id",
+		req.Action, req.ResourceType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.exprs.attach(policies)
+	return EvaluatePolicies(policies, req)
+}
@@ -0,0 +1,854 @@
+package auth
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PolicyFunction is a function callable from policy conditions
+type PolicyFunction func(args ...any) (any, error)
+
+// PolicyFunctions are the functions available to policy conditions.
+// Add functions before compiling conditions which use them.
+var PolicyFunctions = map[string]PolicyFunction{
+	"len":        policyLen,
+	"lower":      stringFunc(strings.ToLower),
+	"upper":      stringFunc(strings.ToUpper),
+	"startsWith": stringPredicate(strings.HasPrefix),
+	"endsWith":   stringPredicate(strings.HasSuffix),
+	"contains":   stringPredicate(strings.Contains),
+	"cidr":       policyCIDR,
+	"hour":       timeFunc(func(t time.Time) float64 { return float64(t.Hour()) }),
+	"weekday":    timeFunc(func(t time.Time) float64 { return float64(t.Weekday()) }),
+}
+
+// Expression is a compiled policy condition such as
+//
+//	resource.amount < 100 && user.department == resource.department
+//
+// Conditions support numbers, strings, booleans, null, lists, member access with dots,
+// the operators || && ! == != < <= > >= in + - * / % and calls to PolicyFunctions.
+// Accessing missing attributes results in null.
+type Expression struct {
+	source string
+	eval   evalFunc
+}
+
+type evalFunc func(vars map[string]any) (any, error)
+
+// CompileExpression compiles a policy condition, see Expression.
+// Returns ErrInvalidPolicy when the condition does not parse.
+func CompileExpression(src string) (*Expression, error) {
+	p := exprParser{src: src}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+
+	eval, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+
+	return &Expression{source: src, eval: eval}, nil
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression with the variables.
+// Returns ErrPolicyEvaluation when operands have the wrong types.
+func (e *Expression) Eval(vars map[string]any) (any, error) {
+	return e.eval(vars)
+}
+
+// EvalBool evaluates the expression which must result in a boolean
+func (e *Expression) EvalBool(vars map[string]any) (bool, error) {
+	v, err := e.eval(vars)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: %s is %s, not a boolean", ErrPolicyEvaluation, e.source, typeName(v))
+	}
+
+	return b, nil
+}
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type exprParser struct {
+	src    string
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s: %s", ErrInvalidPolicy, fmt.Sprintf(format, args...), p.src)
+}
+
+var exprOperators = []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ",", "."}
+
+func (p *exprParser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			var sb strings.Builder
+			for ; j < len(s) && rune(s[j]) != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+
+				sb.WriteByte(s[j])
+			}
+
+			if j >= len(s) {
+				return p.errorf("unterminated string")
+			}
+
+			p.tokens = append(p.tokens, token{tokenString, sb.String(), i})
+			i = j + 1
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+
+			p.tokens = append(p.tokens, token{tokenNumber, s[i:j], i})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+
+			p.tokens = append(p.tokens, token{tokenIdent, s[i:j], i})
+			i = j
+		default:
+			op := ""
+			for _, o := range exprOperators {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+
+			if op == "" {
+				return p.errorf("unexpected character %q", c)
+			}
+
+			p.tokens = append(p.tokens, token{tokenOp, op, i})
+			i += len(op)
+		}
+	}
+
+	return nil
+}
+
+func (p *exprParser) peek(text string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind != tokenString && p.tokens[p.pos].text == text
+}
+
+func (p *exprParser) accept(texts ...string) string {
+	for _, t := range texts {
+		if p.peek(t) {
+			p.pos++
+			return t
+		}
+	}
+
+	return ""
+}
+
+func (p *exprParser) expect(text string) error {
+	if p.accept(text) == "" {
+		return p.errorf("expected %q", text)
+	}
+
+	return nil
+}
+
+func (p *exprParser) parseOr() (evalFunc, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("||") != "" {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = logical(left, right, true)
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (evalFunc, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("&&") != "" {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+
+		left = logical(left, right, false)
+	}
+
+	return left, nil
+}
+
+// logical short circuits, returning short when the left operand equals it
+func logical(left, right evalFunc, short bool) evalFunc {
+	return func(vars map[string]any) (any, error) {
+		l, err := evalBool(left, vars)
+		if err != nil || l == short {
+			return l, err
+		}
+
+		return evalBool(right, vars)
+	}
+}
+
+func evalBool(f evalFunc, vars map[string]any) (bool, error) {
+	v, err := f(vars)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: expected boolean got %s", ErrPolicyEvaluation, typeName(v))
+	}
+
+	return b, nil
+}
+
+func (p *exprParser) parseComparison() (evalFunc, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.accept("==", "!=", "<=", ">=", "<", ">", "in")
+	if op == "" {
+		return left, nil
+	}
+
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	return binary(left, right, func(l, r any) (any, error) {
+		switch op {
+		case "==":
+			return policyEqual(l, r), nil
+		case "!=":
+			return !policyEqual(l, r), nil
+		case "in":
+			return policyIn(l, r)
+		}
+
+		c, err := policyCompare(l, r)
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	}), nil
+}
+
+func (p *exprParser) parseAdditive() (evalFunc, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op := p.accept("+", "-")
+		if op == "" {
+			return left, nil
+		}
+
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+
+		left = binary(left, right, func(l, r any) (any, error) {
+			if ls, ok := l.(string); ok && op == "+" {
+				if rs, ok := r.(string); ok {
+					return ls + rs, nil
+				}
+			}
+
+			return arithmetic(op, l, r)
+		})
+	}
+}
+
+func (p *exprParser) parseMultiplicative() (evalFunc, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op := p.accept("*", "/", "%")
+		if op == "" {
+			return left, nil
+		}
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = binary(left, right, func(l, r any) (any, error) {
+			return arithmetic(op, l, r)
+		})
+	}
+}
+
+func binary(left, right evalFunc, op func(l, r any) (any, error)) evalFunc {
+	return func(vars map[string]any) (any, error) {
+		l, err := left(vars)
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := right(vars)
+		if err != nil {
+			return nil, err
+		}
+
+		return op(l, r)
+	}
+}
+
+func arithmetic(op string, l, r any) (any, error) {
+	a, aok := l.(float64)
+	b, bok := r.(float64)
+	if !aok || !bok {
+		return nil, fmt.Errorf("%w: %s %s %s", ErrPolicyEvaluation, typeName(l), op, typeName(r))
+	}
+
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	}
+
+	if b == 0 {
+		return nil, fmt.Errorf("%w: division by zero", ErrPolicyEvaluation)
+	}
+
+	if op == "%" {
+		return float64(int64(a) % int64(b)), nil
+	}
+
+	return a / b, nil
+}
+
+func (p *exprParser) parseUnary() (evalFunc, error) {
+	op := p.accept("!", "-")
+	if op == "" {
+		return p.parsePostfix()
+	}
+
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(vars map[string]any) (any, error) {
+		if op == "!" {
+			b, err := evalBool(operand, vars)
+			return !b, err
+		}
+
+		v, err := operand(vars)
+		if err != nil {
+			return nil, err
+		}
+
+		return arithmetic("-", 0.0, v)
+	}, nil
+}
+
+func (p *exprParser) parsePostfix() (evalFunc, error) {
+	f, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch {
+		case p.accept(".") != "":
+			if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenIdent {
+				return nil, p.errorf("expected attribute name after '.'")
+			}
+
+			key := p.tokens[p.pos].text
+			p.pos++
+			f = member(f, func(map[string]any) (any, error) { return key, nil })
+		case p.accept("[") != "":
+			index, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+
+			f = member(f, index)
+		default:
+			return f, nil
+		}
+	}
+}
+
+// member accesses a key of a map or an index of a list, accessing null results in null
+func member(obj, key evalFunc) evalFunc {
+	return func(vars map[string]any) (any, error) {
+		o, err := obj(vars)
+		if err != nil {
+			return nil, err
+		}
+
+		k, err := key(vars)
+		if err != nil {
+			return nil, err
+		}
+
+		switch o := o.(type) {
+		case nil:
+			return nil, nil
+		case map[string]any:
+			if s, ok := k.(string); ok {
+				return normalizePolicyValue(o[s]), nil
+			}
+		case []any:
+			if i, ok := k.(float64); ok {
+				if i < 0 || int(i) >= len(o) {
+					return nil, nil
+				}
+
+				return normalizePolicyValue(o[int(i)]), nil
+			}
+		}
+
+		return nil, fmt.Errorf("%w: can not access %s of %s", ErrPolicyEvaluation, typeName(k), typeName(o))
+	}
+}
+
+func (p *exprParser) parsePrimary() (evalFunc, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, p.errorf("unexpected end of expression")
+	}
+
+	t := p.tokens[p.pos]
+	p.pos++
+
+	switch t.kind {
+	case tokenNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", t.text)
+		}
+
+		return constant(n), nil
+	case tokenString:
+		return constant(t.text), nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return constant(true), nil
+		case "false":
+			return constant(false), nil
+		case "null":
+			return constant(nil), nil
+		}
+
+		if p.accept("(") != "" {
+			return p.parseCall(t.text)
+		}
+
+		name := t.text
+		return func(vars map[string]any) (any, error) {
+			return normalizePolicyValue(vars[name]), nil
+		}, nil
+	}
+
+	switch t.text {
+	case "(":
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		return f, p.expect(")")
+	case "[":
+		items, err := p.parseList("]")
+		if err != nil {
+			return nil, err
+		}
+
+		return func(vars map[string]any) (any, error) {
+			list := make([]any, len(items))
+			for i, item := range items {
+				v, err := item(vars)
+				if err != nil {
+					return nil, err
+				}
+
+				list[i] = v
+			}
+
+			return list, nil
+		}, nil
+	}
+
+	return nil, p.errorf("unexpected %q", t.text)
+}
+
+func (p *exprParser) parseCall(name string) (evalFunc, error) {
+	fn, ok := PolicyFunctions[name]
+	if !ok {
+		return nil, p.errorf("unknown function %s", name)
+	}
+
+	args, err := p.parseList(")")
+	if err != nil {
+		return nil, err
+	}
+
+	return func(vars map[string]any) (any, error) {
+		values := make([]any, len(args))
+		for i, arg := range args {
+			v, err := arg(vars)
+			if err != nil {
+				return nil, err
+			}
+
+			values[i] = v
+		}
+
+		v, err := fn(values...)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrPolicyEvaluation, name, err)
+		}
+
+		return normalizePolicyValue(v), nil
+	}, nil
+}
+
+// parseList parses comma separated expressions until the closing token
+func (p *exprParser) parseList(end string) ([]evalFunc, error) {
+	var items []evalFunc
+	if p.accept(end) != "" {
+		return items, nil
+	}
+
+	for {
+		item, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+
+		if p.accept(end) != "" {
+			return items, nil
+		}
+
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func constant(v any) evalFunc {
+	return func(map[string]any) (any, error) { return v, nil }
+}
+
+// normalizePolicyValue converts numbers to float64, slices to []any and maps to map[string]any
+// so that values from go and from json compare the same
+func normalizePolicyValue(v any) any {
+	switch v := v.(type) {
+	case nil, bool, string, float64, time.Time, []any, map[string]any:
+		return v
+	case Attributes:
+		return map[string]any(v)
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+
+		return *v
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.String:
+		return rv.String()
+	case reflect.Slice, reflect.Array:
+		list := make([]any, rv.Len())
+		for i := range list {
+			list[i] = normalizePolicyValue(rv.Index(i).Interface())
+		}
+
+		return list
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			m := make(map[string]any, rv.Len())
+			for _, k := range rv.MapKeys() {
+				m[k.String()] = rv.MapIndex(k).Interface()
+			}
+
+			return m
+		}
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return nil
+		}
+
+		return normalizePolicyValue(rv.Elem().Interface())
+	}
+
+	return v
+}
+
+func policyEqual(l, r any) bool {
+	l, r = normalizePolicyValue(l), normalizePolicyValue(r)
+	if lt, ok := l.(time.Time); ok {
+		rt, ok := r.(time.Time)
+		return ok && lt.Equal(rt)
+	}
+
+	return reflect.DeepEqual(l, r)
+}
+
+func policyCompare(l, r any) (int, error) {
+	switch l := l.(type) {
+	case float64:
+		if r, ok := r.(float64); ok {
+			switch {
+			case l < r:
+				return -1, nil
+			case l > r:
+				return 1, nil
+			}
+
+			return 0, nil
+		}
+	case string:
+		if r, ok := r.(string); ok {
+			return strings.Compare(l, r), nil
+		}
+	case time.Time:
+		if r, ok := r.(time.Time); ok {
+			return l.Compare(r), nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: can not compare %s with %s", ErrPolicyEvaluation, typeName(l), typeName(r))
+}
+
+func policyIn(l, r any) (bool, error) {
+	switch r := r.(type) {
+	case []any:
+		for _, v := range r {
+			if policyEqual(l, v) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	case string:
+		if l, ok := l.(string); ok {
+			return strings.Contains(r, l), nil
+		}
+	case map[string]any:
+		if l, ok := l.(string); ok {
+			_, found := r[l]
+			return found, nil
+		}
+	case nil:
+		return false, nil
+	}
+
+	return false, fmt.Errorf("%w: %s in %s", ErrPolicyEvaluation, typeName(l), typeName(r))
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case time.Time:
+		return "time"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "map"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+func policyLen(args ...any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected 1 argument got %d", len(args))
+	}
+
+	switch v := args[0].(type) {
+	case string:
+		return len(v), nil
+	case []any:
+		return len(v), nil
+	case map[string]any:
+		return len(v), nil
+	case nil:
+		return 0, nil
+	}
+
+	return nil, fmt.Errorf("can not get length of %s", typeName(args[0]))
+}
+
+func stringFunc(f func(string) string) PolicyFunction {
+	return func(args ...any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument got %d", len(args))
+		}
+
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string got %s", typeName(args[0]))
+		}
+
+		return f(s), nil
+	}
+}
+
+func stringPredicate(f func(s, sub string) bool) PolicyFunction {
+	return func(args ...any) (any, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("expected 2 arguments got %d", len(args))
+		}
+
+		s, ok := args[0].(string)
+		sub, ok2 := args[1].(string)
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("expected strings got %s and %s", typeName(args[0]), typeName(args[1]))
+		}
+
+		return f(s, sub), nil
+	}
+}
+
+func timeFunc(f func(time.Time) float64) PolicyFunction {
+	return func(args ...any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument got %d", len(args))
+		}
+
+		t, ok := args[0].(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("expected time got %s", typeName(args[0]))
+		}
+
+		return f(t), nil
+	}
+}
+
+// policyCIDR reports whether the ip is within the network, cidr(env.ip, "10.0.0.0/8")
+func policyCIDR(args ...any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("expected 2 arguments got %d", len(args))
+	}
+
+	ip, ok := args[0].(string)
+	network, ok2 := args[1].(string)
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("expected strings got %s and %s", typeName(args[0]), typeName(args[1]))
+	}
+
+	prefix, err := netip.ParsePrefix(network)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false, nil
+	}
+
+	return prefix.Contains(addr.Unmap()), nil
+}
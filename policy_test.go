@@ -0,0 +1,139 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cristosal/auth"
+)
+
+func TestExpressionEval(t *testing.T) {
+	vars := map[string]any{
+		"user":     map[string]any{"id": int64(7), "department": "sales", "roles": []string{"agent", "lead"}},
+		"resource": auth.Attributes{"amount": 99.5, "department": "sales", "tags": []any{"vip"}},
+		"env":      map[string]any{"ip": "10.1.2.3", "time": time.Date(2023, 11, 20, 9, 0, 0, 0, time.UTC)},
+	}
+
+	tt := []struct {
+		src      string
+		expected any
+	}{
+		{"resource.amount < 100 && user.department == resource.department", true},
+		{"resource.amount >= 100 || user.id == 7", true},
+		{"!(user.id != 7)", true},
+		{"'lead' in user.roles", true},
+		{"'admin' in user.roles", false},
+		{"resource.tags[0] == \"vip\"", true},
+		{"resource.missing == null", true},
+		{"resource.missing.deeper == null", true},
+		{"user.id * 2 + 1", 15.0},
+		{"-resource.amount", -99.5},
+		{"len(user.roles) == 2", true},
+		{"startsWith(lower('SALES'), 'sa')", true},
+		{"cidr(env.ip, '10.0.0.0/8') && !cidr(env.ip, '192.168.0.0/16')", true},
+		{"hour(env.time) >= 9 && hour(env.time) < 17 && weekday(env.time) == 1", true},
+		{"'a' + 'b' == 'ab'", true},
+		{"[1, 2, 3][1]", 2.0},
+	}
+
+	for _, tc := range tt {
+		expr, err := auth.CompileExpression(tc.src)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.src, err)
+		}
+
+		v, err := expr.Eval(vars)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.src, err)
+		}
+
+		if v != tc.expected {
+			t.Fatalf("%s: expected %v got %v", tc.src, tc.expected, v)
+		}
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	for _, src := range []string{"", "1 +", "(true", "unknown(1)", "'unterminated", "user.", "a # b"} {
+		if _, err := auth.CompileExpression(src); !errors.Is(err, auth.ErrInvalidPolicy) {
+			t.Fatalf("%q: expected invalid policy got %v", src, err)
+		}
+	}
+
+	vars := map[string]any{"n": 1, "s": "x"}
+	for _, src := range []string{"n < s", "n && true", "n / 0", "s - 1", "1 in n"} {
+		expr, err := auth.CompileExpression(src)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+
+		if _, err := expr.Eval(vars); !errors.Is(err, auth.ErrPolicyEvaluation) {
+			t.Fatalf("%s: expected evaluation error got %v", src, err)
+		}
+	}
+}
+
+func TestRunPolicyTests(t *testing.T) {
+	policies := []auth.Policy{
+		{Name: "small refunds", Action: "refund", Effect: auth.PolicyAllow, Condition: "resource.amount < 100 && user.department == resource.department"},
+		{Name: "managers", Action: "refund", Effect: auth.PolicyAllow, Condition: "'managers' in user.groups"},
+		{Name: "suspicious", Action: "refund", Effect: auth.PolicyDeny, Condition: "resource.flagged == true"},
+	}
+
+	sales := &auth.User{ID: 1, Attributes: auth.Attributes{"department": "sales"}}
+	manager := &auth.Session{User: &auth.User{ID: 2}, Groups: auth.Groups{{Name: "managers"}}}
+
+	tests := []auth.PolicyTest{
+		{Name: "small refund", Request: auth.PolicyRequest{User: sales, Action: "refund", Resource: auth.Attributes{"amount": 50, "department": "sales"}}, Expected: true},
+		{Name: "large refund", Request: auth.PolicyRequest{User: sales, Action: "refund", Resource: auth.Attributes{"amount": 500, "department": "sales"}}, Expected: false},
+		{Name: "other department", Request: auth.PolicyRequest{User: sales, Action: "refund", Resource: auth.Attributes{"amount": 50, "department": "support"}}, Expected: false},
+		{Name: "manager", Request: auth.PolicyRequest{Session: manager, Action: "refund", Resource: auth.Attributes{"amount": 500}}, Expected: true},
+		{Name: "flagged", Request: auth.PolicyRequest{Session: manager, Action: "refund", Resource: auth.Attributes{"amount": 5, "flagged": true}}, Expected: false},
+		{Name: "other action", Request: auth.PolicyRequest{Session: manager, Action: "delete"}, Expected: false},
+	}
+
+	if err := auth.RunPolicyTests(policies, tests); err != nil {
+		t.Fatal(err)
+	}
+
+	tests[0].Expected = false
+	if err := auth.RunPolicyTests(policies, tests); err == nil {
+		t.Fatal("expected harness to report the failing test")
+	}
+
+	d, err := auth.EvaluatePolicies(policies, &tests[4].Request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Allowed || d.Policy == nil || d.Policy.Name != "suspicious" {
+		t.Fatalf("expected deny policy to decide got %+v", d)
+	}
+
+	// deny policies fail closed, allow policies which fail to evaluate do not hold
+	brokenDeny := auth.Policy{Name: "broken deny", Action: "refund", Effect: auth.PolicyDeny, Condition: "resource.amount < 'x'"}
+	brokenAllow := auth.Policy{Name: "broken allow", Action: "refund", Effect: auth.PolicyAllow, Condition: "resource.amount < 'x'"}
+
+	d, err = auth.EvaluatePolicies(append(policies, brokenDeny), &tests[3].Request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Allowed || d.Policy == nil || d.Policy.Name != brokenDeny.Name || len(d.Errors) != 1 {
+		t.Fatalf("expected failing deny policy to deny got %+v", d)
+	}
+
+	d, err = auth.EvaluatePolicies(append(policies, brokenAllow), &tests[3].Request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !d.Allowed || d.Policy == nil || d.Policy.Name != "managers" || len(d.Errors) != 1 {
+		t.Fatalf("expected failing allow policy not to hold got %+v", d)
+	}
+
+	if err := auth.RunPolicyTests(append(policies, brokenDeny), tests[3:4]); !errors.Is(err, auth.ErrPolicyEvaluation) {
+		t.Fatalf("expected harness to report the failing policy got %v", err)
+	}
+}
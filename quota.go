@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+type QuotaWindow string
+
+const (
+	QuotaLifetime QuotaWindow = ""        // usage never resets, such as a maximum amount of projects
+	QuotaDaily    QuotaWindow = "daily"   // usage resets at midnight utc
+	QuotaWeekly   QuotaWindow = "weekly"  // usage resets on monday at midnight utc
+	QuotaMonthly  QuotaWindow = "monthly" // usage resets on the first of the month at midnight utc
+)
+
+// QuotaWindowBounds returns the start of the window containing t and when it resets.
+// Lifetime windows start at the unix epoch and never reset.
+func QuotaWindowBounds(window QuotaWindow, t time.Time) (time.Time, *time.Time) {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	var start, end time.Time
+	switch window {
+	case QuotaDaily:
+		start, end = day, day.AddDate(0, 0, 1)
+	case QuotaWeekly:
+		start = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		end = start.AddDate(0, 0, 7)
+	case QuotaMonthly:
+		start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 1, 0)
+	default:
+		return time.Unix(0, 0).UTC(), nil
+	}
+
+	return start, &end
+}
+
+// QuotaUsage is the usage of a quantity permission by a user within the current window
+type QuotaUsage struct {
+	Permission string
+	Window     QuotaWindow
+	Limit      int // effective value of the permission
+	Used       int
+	Remaining  int
+	ResetsAt   *time.Time // nil when usage never resets
+}
+
+// QuotaRecord is the usage of a quantity permission by a user within a window as stored
+type QuotaRecord struct {
+	UserID       int64
+	PermissionID int64
+	WindowStart  time.Time
+	ResetsAt     *time.Time
+	Used         int
+	UpdatedAt    time.Time
+}
+
+func (QuotaRecord) TableName() string {
+	return "quota_usage"
+}
+
+// QuotaRepo tracks usage of quantity permissions against their effective value.
+// Usage resets with the window of the permission, see Permission.QuotaWindow.
+type QuotaRepo struct {
+	db     orm.DB
+	groups *GroupRepo
+}
+
+func NewQuotaRepo(db orm.DB) *QuotaRepo {
+	return &QuotaRepo{db: db, groups: NewGroupRepo(db)}
+}
+
+// Consume records usage of n of the permission by the user and returns the remaining amount.
+// Returns ErrQuotaExceeded without recording any usage when the effective value of the permission would be exceeded.
+// Returns ErrNotQuantity when the permission is not a quantity.
+// Concurrent calls can not exceed the value together.
+func (r *QuotaRepo) Consume(uid int64, perm string, n int) (int, error) {
+	if n < 1 {
+		return 0, ErrInvalidQuantity
+	}
+
+	gp, limit, err := r.limit(uid, perm)
+	if err != nil {
+		return 0, err
+	}
+
+	if n > limit {
+		return 0, ErrQuotaExceeded
+	}
+
+	pid := gp.PermissionID
+	start, end := QuotaWindowBounds(gp.Window, time.Now())
+
+	var used int
+	row := r.db.QueryRow(`insert into quota_usage (user_id, permission_id, window_start, resets_at, used) values ($1, $2, $3, $4, $5)
+		on conflict (user_id, permission_id, window_start) do update set used = quota_usage.used + excluded.used, updated_at = now()
+		where quota_usage.used + excluded.used <= $6
+		returning used`, uid, pid, start, end, n, limit)
+
+	if err := row.Scan(&used); err != nil {
+		if errors.Is(err, orm.ErrNotFound) {
+			return 0, ErrQuotaExceeded
+		}
+
+		return 0, err
+	}
+
+	return limit - used, nil
+}
+
+// Release returns n of the permission to the user within the current window, such as when a project is deleted.
+// Usage does not drop below zero.
+// Returns ErrNotQuantity when the permission is not a quantity.
+func (r *QuotaRepo) Release(uid int64, perm string, n int) error {
+	if n < 1 {
+		return ErrInvalidQuantity
+	}
+
+	var p Permission
+	if err := orm.Get(r.db, &p, "where name = $1", perm); err != nil {
+		if errors.Is(err, orm.ErrNotFound) {
+			return ErrPermissionNotFound
+		}
+
+		return err
+	}
+
+	if p.Type != Quantity {
+		return ErrNotQuantity
+	}
+
+	start, _ := QuotaWindowBounds(p.QuotaWindow, time.Now())
+	return orm.Exec(r.db, `update quota_usage set used = greatest(used - $1, 0), updated_at = now()
+		where user_id = $2 and permission_id = $3 and window_start = $4`,
+		n, uid, p.ID, start)
+}
+
+// Usage reports the usage of every quantity permission granted to the user ordered by permission name
+func (r *QuotaRepo) Usage(uid int64) ([]QuotaUsage, error) {
+	perms, err := r.groups.UserPermissions(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		report = make([]QuotaUsage, 0)
+		seen   = make(map[string]bool)
+		now    = time.Now()
+	)
+
+	for i := range perms {
+		name := perms[i].Name
+		if perms[i].Type != Quantity || seen[name] {
+			continue
+		}
+
+		seen[name] = true
+
+		e := perms.Explain(name)
+		if !e.Granted {
+			continue
+		}
+
+		window := e.Winner.Window
+		start, end := QuotaWindowBounds(window, now)
+
+		var used int
+		row := r.db.QueryRow("select used from quota_usage where user_id = $1 and permission_id = $2 and window_start = $3",
+			uid, e.Winner.PermissionID, start)
+
+		if err := row.Scan(&used); err != nil && !errors.Is(err, orm.ErrNotFound) {
+			return nil, err
+		}
+
+		report = append(report, QuotaUsage{
+			Permission: name,
+			Window:     window,
+			Limit:      e.Value,
+			Used:       used,
+			Remaining:  max(e.Value-used, 0),
+			ResetsAt:   end,
+		})
+	}
+
+	sort.Slice(report, func(i, j int) bool { return report[i].Permission < report[j].Permission })
+	return report, nil
+}
+
+// RemoveExpired deletes usage of windows which have been reset
+func (r *QuotaRepo) RemoveExpired() error {
+	return orm.Exec(r.db, "delete from quota_usage where resets_at < now()")
+}
+
+// limit returns the winning entry of the permission and its effective value for the user.
+// Returns ErrQuotaExceeded when the permission is not granted and ErrNotQuantity when it is not a quantity.
+func (r *QuotaRepo) limit(uid int64, perm string) (*GroupPermission, int, error) {
+	perms, err := r.groups.UserPermissions(uid)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	e := perms.Explain(perm)
+	if !e.Granted {
+		return nil, 0, ErrQuotaExceeded
+	}
+
+	if e.Winner.Type != Quantity {
+		return nil, 0, ErrNotQuantity
+	}
+
+	return e.Winner, e.Value, nil
+}
@@ -0,0 +1,129 @@
+package auth_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cristosal/auth"
+)
+
+func TestQuotaWindowBounds(t *testing.T) {
+	// wednesday
+	now := time.Date(2023, 11, 22, 15, 30, 0, 0, time.UTC)
+
+	tt := []struct {
+		window auth.QuotaWindow
+		start  time.Time
+		end    time.Time
+	}{
+		{auth.QuotaDaily, time.Date(2023, 11, 22, 0, 0, 0, 0, time.UTC), time.Date(2023, 11, 23, 0, 0, 0, 0, time.UTC)},
+		{auth.QuotaWeekly, time.Date(2023, 11, 20, 0, 0, 0, 0, time.UTC), time.Date(2023, 11, 27, 0, 0, 0, 0, time.UTC)},
+		{auth.QuotaMonthly, time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tt {
+		start, end := auth.QuotaWindowBounds(tc.window, now)
+		if !start.Equal(tc.start) || end == nil || !end.Equal(tc.end) {
+			t.Fatalf("%s: expected %v - %v got %v - %v", tc.window, tc.start, tc.end, start, end)
+		}
+	}
+
+	sunday := time.Date(2023, 11, 26, 23, 0, 0, 0, time.UTC)
+	if start, _ := auth.QuotaWindowBounds(auth.QuotaWeekly, sunday); !start.Equal(tt[1].start) {
+		t.Fatalf("expected sunday to belong to the week starting monday got %v", start)
+	}
+
+	if _, end := auth.QuotaWindowBounds(auth.QuotaLifetime, now); end != nil {
+		t.Fatal("expected lifetime window to never reset")
+	}
+}
+
+func TestQuotaConsume(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	perm := auth.Permission{Name: "quota_projects", Type: auth.Quantity, QuotaWindow: auth.QuotaMonthly}
+	if err := svc.Permissions().Add(&perm); err != nil {
+		t.Fatal(err)
+	}
+
+	access := auth.Permission{Name: "quota_access", Type: auth.Access}
+	if err := svc.Permissions().Add(&access); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := svc.Users().Register(&auth.RegistrationRequest{Name: "Quota User", Email: "quota@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		svc.EraseUser(res.UserID)
+		svc.Permissions().RemoveByName(perm.Name)
+		svc.Permissions().RemoveByName(access.Name)
+	})
+
+	if err := svc.Users().GrantPermission(res.UserID, perm.ID, 5, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Users().GrantPermission(res.UserID, access.ID, 5, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.Quotas().Consume(res.UserID, access.Name, 1); !errors.Is(err, auth.ErrNotQuantity) {
+		t.Fatalf("expected access permission to be refused got %v", err)
+	}
+
+	if err := svc.Quotas().Release(res.UserID, access.Name, 1); !errors.Is(err, auth.ErrNotQuantity) {
+		t.Fatalf("expected access permission to be refused got %v", err)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		consumed int
+	)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.Quotas().Consume(res.UserID, perm.Name, 1)
+			if err == nil {
+				mu.Lock()
+				consumed++
+				mu.Unlock()
+			} else if !errors.Is(err, auth.ErrQuotaExceeded) {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if consumed != 5 {
+		t.Fatalf("expected 5 consumptions got %d", consumed)
+	}
+
+	if err := svc.Quotas().Release(res.UserID, perm.Name, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := svc.Quotas().Usage(res.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report) != 1 || report[0].Used != 3 || report[0].Remaining != 2 {
+		t.Fatalf("unexpected usage report %+v", report)
+	}
+
+	if report[0].Window != auth.QuotaMonthly || report[0].ResetsAt == nil {
+		t.Fatalf("expected monthly window of the permission got %+v", report[0])
+	}
+}
@@ -3,6 +3,7 @@ package auth
 import (
 	"errors"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v7"
@@ -112,3 +113,79 @@ func (l *RedisLimiter) expire(key string, duration time.Duration) error {
 func (l *RedisLimiter) ttl(key string) (time.Duration, error) {
 	return l.cl.TTL(key).Result()
 }
+
+// MemoryLimiter is the implementation for Limiter keeping hit counts in memory.
+// Limits are only shared within the process, use RedisLimiter when running multiple processes.
+type MemoryLimiter struct {
+	mu    sync.Mutex
+	hits  map[string]*memoryHits
+	swept time.Time // expired keys are removed at most once a minute
+}
+
+type memoryHits struct {
+	count   int
+	expires time.Time
+}
+
+// NewMemoryLimiter returns a Limiter implementation keeping hit counts in memory
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{hits: make(map[string]*memoryHits)}
+}
+
+// Limit is the implementation of Limiter interface.
+// It returns ErrLimitReached when attempts have been exceeded.
+func (l *MemoryLimiter) Limit(key string, max int, window time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	h := l.get(key)
+	if h.count >= max {
+		return ErrLimitReached
+	}
+
+	// like redis the expiry window is updated on every hit
+	h.count++
+	h.expires = time.Now().Add(window)
+	return nil
+}
+
+func (l *MemoryLimiter) TTL(key string, max int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if h := l.get(key); h.count >= max {
+		return time.Until(h.expires)
+	}
+
+	return 0
+}
+
+func (l *MemoryLimiter) Reset(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.hits, key)
+	return nil
+}
+
+// get returns the unexpired hits of the key
+func (l *MemoryLimiter) get(key string) *memoryHits {
+	now := time.Now()
+	if now.Sub(l.swept) > time.Minute {
+		for k, h := range l.hits {
+			if !h.expires.After(now) {
+				delete(l.hits, k)
+			}
+		}
+
+		l.swept = now
+	}
+
+	h, ok := l.hits[key]
+	if !ok || !h.expires.After(now) {
+		h = new(memoryHits)
+		l.hits[key] = h
+	}
+
+	return h
+}
@@ -86,3 +86,40 @@ func TestRateLimiter(t *testing.T) {
 	}
 
 }
+
+func TestMemoryLimiter(t *testing.T) {
+	var (
+		l   = NewMemoryLimiter()
+		max = 3
+		k   = "test-memory"
+	)
+
+	for i := 0; i < max; i++ {
+		if err := l.Limit(k, max, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := l.Limit(k, max, time.Minute); err != ErrLimitReached {
+		t.Fatalf("expected limit reached got %v", err)
+	}
+
+	if ttl := l.TTL(k, max); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("expected ttl within a minute got %v", ttl)
+	}
+
+	if err := l.Reset(k); err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl := l.TTL(k, max); ttl != 0 {
+		t.Fatalf("expected reset limit got %v", ttl)
+	}
+
+	l.Limit(k, 1, time.Millisecond)
+	time.Sleep(time.Millisecond * 5)
+
+	if err := l.Limit(k, 1, time.Millisecond); err != nil {
+		t.Fatalf("expected limit to expire got %v", err)
+	}
+}
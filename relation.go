@@ -0,0 +1,310 @@
+package auth
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	SubjectUser    = "user"   // object type of users in relation tuples
+	NamespaceGroup = "group"  // object type of groups, see RelationMember
+	RelationMember = "member" // members of groups including members of subgroups
+)
+
+// Subject is a user such as user:1 or a set of users such as group:5#member
+type Subject struct {
+	Type     string
+	ID       string
+	Relation string // empty for a single subject
+}
+
+func (s Subject) String() string {
+	if s.Relation == "" {
+		return s.Type + ":" + s.ID
+	}
+
+	return s.Type + ":" + s.ID + "#" + s.Relation
+}
+
+// UserSubject returns the subject of a user
+func UserSubject(uid int64) Subject {
+	return Subject{Type: SubjectUser, ID: fmt.Sprint(uid)}
+}
+
+// Tuple relates a subject to an object, written as object#relation@subject such as doc:1#viewer@group:5#member
+type Tuple struct {
+	ObjectType      string
+	ObjectID        string
+	Relation        string
+	SubjectType     string
+	SubjectID       string
+	SubjectRelation string
+}
+
+func (Tuple) TableName() string {
+	return "relation_tuples"
+}
+
+// Subject returns the subject of the tuple
+func (t *Tuple) Subject() Subject {
+	return Subject{Type: t.SubjectType, ID: t.SubjectID, Relation: t.SubjectRelation}
+}
+
+func (t Tuple) String() string {
+	return t.ObjectType + ":" + t.ObjectID + "#" + t.Relation + "@" + t.Subject().String()
+}
+
+// NewTuple returns a tuple relating the subject to the object
+func NewTuple(objectType, objectID, relation string, subject Subject) Tuple {
+	return Tuple{
+		ObjectType:      objectType,
+		ObjectID:        objectID,
+		Relation:        relation,
+		SubjectType:     subject.Type,
+		SubjectID:       subject.ID,
+		SubjectRelation: subject.Relation,
+	}
+}
+
+// ParseTuple parses a tuple written as object#relation@subject.
+// Returns ErrInvalidTuple when malformed.
+func ParseTuple(s string) (Tuple, error) {
+	object, subject, ok := strings.Cut(s, "@")
+	if !ok {
+		return Tuple{}, fmt.Errorf("%w: %s", ErrInvalidTuple, s)
+	}
+
+	obj, err := parseSubject(object)
+	if err != nil || obj.Relation == "" {
+		return Tuple{}, fmt.Errorf("%w: %s", ErrInvalidTuple, s)
+	}
+
+	sub, err := parseSubject(subject)
+	if err != nil {
+		return Tuple{}, fmt.Errorf("%w: %s", ErrInvalidTuple, s)
+	}
+
+	return NewTuple(obj.Type, obj.ID, obj.Relation, sub), nil
+}
+
+// parseSubject parses type:id or type:id#relation
+func parseSubject(s string) (Subject, error) {
+	var sub Subject
+	s, sub.Relation, _ = strings.Cut(s, "#")
+	sub.Type, sub.ID, _ = strings.Cut(s, ":")
+
+	if sub.Type == "" || sub.ID == "" || strings.ContainsAny(sub.ID, "#@") {
+		return sub, ErrInvalidTuple
+	}
+
+	return sub, nil
+}
+
+// Namespace configures the relations of an object type.
+// Each relation lists the relations of the same object which imply it, for documents:
+//
+//	auth.Namespace{"owner": nil, "editor": {"owner"}, "viewer": {"editor"}}
+//
+// makes owners editors and editors viewers.
+type Namespace map[string][]string
+
+// Namespaces configures relations by object type
+type Namespaces map[string]Namespace
+
+// implying returns the relation along with every relation implying it, directly or through other relations
+func (ns Namespaces) implying(objectType, relation string) []string {
+	var (
+		seen = map[string]bool{relation: true}
+		rels = []string{relation}
+	)
+
+	for i := 0; i < len(rels); i++ {
+		for _, r := range ns[objectType][rels[i]] {
+			if !seen[r] {
+				seen[r] = true
+				rels = append(rels, r)
+			}
+		}
+	}
+
+	return rels
+}
+
+// implied returns the relation along with every relation it implies
+func (ns Namespaces) implied(objectType, relation string) []string {
+	var rels []string
+	for r := range ns[objectType] {
+		for _, ir := range ns.implying(objectType, r) {
+			if ir == relation && r != relation {
+				rels = append(rels, r)
+				break
+			}
+		}
+	}
+
+	sort.Strings(rels)
+	return append([]string{relation}, rels...)
+}
+
+// TupleStore stores relation tuples, see TupleRepo and MemoryTupleStore
+type TupleStore interface {
+	// Write adds tuples, no error will occur if a tuple already exists
+	Write(tuples ...Tuple) error
+
+	// Delete removes tuples, no error will occur if a tuple does not exist
+	Delete(tuples ...Tuple) error
+
+	// Subjects returns the subjects related to the object by the relation
+	Subjects(objectType, objectID, relation string) ([]Subject, error)
+
+	// Lookup returns the tuples with any of the subjects
+	Lookup(subjects ...Subject) ([]Tuple, error)
+}
+
+// UsersetTree is the expansion of object#relation into the subjects related to it
+type UsersetTree struct {
+	Subject  Subject        // object and relation which was expanded
+	Subjects []Subject      // subjects related directly
+	Children []*UsersetTree // expanded usersets and implying relations
+}
+
+// RelationEngine answers relationship questions such as whether a user can view a document
+type RelationEngine struct {
+	store      TupleStore
+	namespaces Namespaces
+}
+
+// NewRelationEngine returns an engine reading tuples from the store with the relations configured by namespaces.
+// The namespaces must not be modified afterwards.
+func NewRelationEngine(store TupleStore, namespaces Namespaces) *RelationEngine {
+	return &RelationEngine{store: store, namespaces: namespaces}
+}
+
+// Store returns the store of the engine for writing and deleting tuples
+func (e *RelationEngine) Store() TupleStore {
+	return e.store
+}
+
+// Check returns true when the subject has the relation to the object,
+// either directly, through a userset such as group:5#member or through a relation implying it.
+func (e *RelationEngine) Check(objectType, objectID, relation string, subject Subject) (bool, error) {
+	return e.check(Subject{objectType, objectID, relation}, subject, make(map[Subject]bool))
+}
+
+func (e *RelationEngine) check(userset, subject Subject, visited map[Subject]bool) (bool, error) {
+	for _, rel := range e.namespaces.implying(userset.Type, userset.Relation) {
+		us := Subject{userset.Type, userset.ID, rel}
+		if visited[us] {
+			continue
+		}
+
+		visited[us] = true
+
+		subjects, err := e.store.Subjects(us.Type, us.ID, us.Relation)
+		if err != nil {
+			return false, err
+		}
+
+		for _, s := range subjects {
+			if s == subject {
+				return true, nil
+			}
+		}
+
+		for _, s := range subjects {
+			if s.Relation == "" {
+				continue
+			}
+
+			if ok, err := e.check(s, subject, visited); ok || err != nil {
+				return ok, err
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// Expand returns the tree of subjects related to the object by the relation.
+// Usersets already expanded elsewhere in the tree are not expanded again.
+func (e *RelationEngine) Expand(objectType, objectID, relation string) (*UsersetTree, error) {
+	return e.expand(Subject{objectType, objectID, relation}, make(map[Subject]bool))
+}
+
+func (e *RelationEngine) expand(userset Subject, visited map[Subject]bool) (*UsersetTree, error) {
+	visited[userset] = true
+	tree := UsersetTree{Subject: userset}
+
+	subjects, err := e.store.Subjects(userset.Type, userset.ID, userset.Relation)
+	if err != nil {
+		return nil, err
+	}
+
+	tree.Subjects = subjects
+
+	var children []Subject
+	for _, rel := range e.namespaces.implying(userset.Type, userset.Relation)[1:] {
+		children = append(children, Subject{userset.Type, userset.ID, rel})
+	}
+
+	for _, s := range subjects {
+		if s.Relation != "" {
+			children = append(children, s)
+		}
+	}
+
+	for _, us := range children {
+		if visited[us] {
+			continue
+		}
+
+		child, err := e.expand(us, visited)
+		if err != nil {
+			return nil, err
+		}
+
+		tree.Children = append(tree.Children, child)
+	}
+
+	return &tree, nil
+}
+
+// ListObjects returns the ids of the objects of a type which the subject has the relation to, ordered by id.
+// The usersets containing the subject are looked up a level at a time, one store lookup per level.
+func (e *RelationEngine) ListObjects(objectType, relation string, subject Subject) ([]string, error) {
+	var (
+		visited = map[Subject]bool{subject: true}
+		level   = []Subject{subject}
+		ids     = make([]string, 0)
+		found   = make(map[string]bool)
+	)
+
+	for len(level) > 0 {
+		tuples, err := e.store.Lookup(level...)
+		if err != nil {
+			return nil, err
+		}
+
+		level = nil
+		for _, t := range tuples {
+			for _, rel := range e.namespaces.implied(t.ObjectType, t.Relation) {
+				us := Subject{t.ObjectType, t.ObjectID, rel}
+				if visited[us] {
+					continue
+				}
+
+				visited[us] = true
+				level = append(level, us)
+
+				if us.Type == objectType && us.Relation == relation && !found[us.ID] {
+					found[us.ID] = true
+					ids = append(ids, us.ID)
+				}
+			}
+		}
+	}
+
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/cristosal/orm"
+)
+
+// TupleRepo stores relation tuples in postgres.
+// Group memberships are read from the groups and group_users tables as group:id#member,
+// members of a subgroup are members of its parent through group:parent#member@group:child#member.
+// Memberships are managed through GroupRepo and can not be written as tuples.
+type TupleRepo struct{ db orm.DB }
+
+func NewTupleRepo(db orm.DB) *TupleRepo {
+	return &TupleRepo{db}
+}
+
+// Write adds tuples in a single transaction.
+// Returns ErrInvalidTuple for group memberships or tuples with missing fields.
+func (r *TupleRepo) Write(tuples ...Tuple) error {
+	return r.exec(`insert into relation_tuples (object_type, object_id, relation, subject_type, subject_id, subject_relation)
+		values ($1, $2, $3, $4, $5, $6) on conflict do nothing`, tuples)
+}
+
+// Delete removes tuples in a single transaction
+func (r *TupleRepo) Delete(tuples ...Tuple) error {
+	return r.exec(`delete from relation_tuples where object_type = $1 and object_id = $2 and relation = $3
+		and subject_type = $4 and subject_id = $5 and subject_relation = $6`, tuples)
+}
+
+func (r *TupleRepo) exec(sql string, tuples []Tuple) error {
+	for i := range tuples {
+		if err := tuples[i].validate(); err != nil {
+			return err
+		}
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for _, t := range tuples {
+		if _, err := tx.Exec(sql, t.ObjectType, t.ObjectID, t.Relation, t.SubjectType, t.SubjectID, t.SubjectRelation); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Subjects returns the subjects related to the object by the relation
+func (r *TupleRepo) Subjects(objectType, objectID, relation string) ([]Subject, error) {
+	sql := "select subject_type, subject_id, subject_relation from relation_tuples where object_type = $1 and object_id = $2 and relation = $3"
+	args := []any{objectType, objectID, relation}
+
+	if gid, ok := groupMemberID(objectType, objectID, relation); ok {
+		sql = `select 'user', user_id::text, '' from group_users where group_id = $1
+			union all
+			select 'group', id::text, 'member' from groups where parent_id = $1`
+		args = []any{gid}
+	}
+
+	rows, err := r.db.Query(sql+" order by 1, 2, 3", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var subjects []Subject
+	for rows.Next() {
+		var s Subject
+		if err := rows.Scan(&s.Type, &s.ID, &s.Relation); err != nil {
+			return nil, err
+		}
+
+		subjects = append(subjects, s)
+	}
+
+	return subjects, rows.Err()
+}
+
+// Lookup returns the tuples with any of the subjects, including group memberships
+func (r *TupleRepo) Lookup(subjects ...Subject) ([]Tuple, error) {
+	if len(subjects) == 0 {
+		return nil, nil
+	}
+
+	var (
+		types = make([]string, len(subjects))
+		ids   = make([]string, len(subjects))
+		rels  = make([]string, len(subjects))
+		uids  []int64 // users whose groups are looked up
+		gids  []int64 // groups whose parents are looked up
+	)
+
+	for i, s := range subjects {
+		types[i], ids[i], rels[i] = s.Type, s.ID, s.Relation
+
+		id, err := strconv.ParseInt(s.ID, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case s.Type == SubjectUser && s.Relation == "":
+			uids = append(uids, id)
+		case s.Type == NamespaceGroup && s.Relation == RelationMember:
+			gids = append(gids, id)
+		}
+	}
+
+	var tuples []Tuple
+	err := orm.List(r.db, &tuples, `where (subject_type, subject_id, subject_relation) in
+		(select * from unnest($1::text[], $2::text[], $3::text[]))`, types, ids, rels)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(uids) == 0 && len(gids) == 0 {
+		return tuples, nil
+	}
+
+	rows, err := r.db.Query(`select 'user', user_id::text, '', group_id from group_users where user_id = any($1)
+		union all
+		select 'group', id::text, 'member', parent_id from groups where id = any($2) and parent_id is not null`, uids, gids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			s   Subject
+			gid int64
+		)
+
+		if err := rows.Scan(&s.Type, &s.ID, &s.Relation, &gid); err != nil {
+			return nil, err
+		}
+
+		tuples = append(tuples, NewTuple(NamespaceGroup, strconv.FormatInt(gid, 10), RelationMember, s))
+	}
+
+	return tuples, rows.Err()
+}
+
+// validate returns ErrInvalidTuple when fields are missing or the tuple is a group membership
+func (t *Tuple) validate() error {
+	if t.ObjectType == "" || t.ObjectID == "" || t.Relation == "" || t.SubjectType == "" || t.SubjectID == "" {
+		return fmt.Errorf("%w: %s", ErrInvalidTuple, t)
+	}
+
+	if t.ObjectType == NamespaceGroup && t.Relation == RelationMember {
+		return fmt.Errorf("%w: group memberships are managed through GroupRepo: %s", ErrInvalidTuple, t)
+	}
+
+	return nil
+}
+
+// groupMemberID returns the group id when the object and relation are a group membership
+func groupMemberID(objectType, objectID, relation string) (int64, bool) {
+	if objectType != NamespaceGroup || relation != RelationMember {
+		return 0, false
+	}
+
+	gid, err := strconv.ParseInt(objectID, 10, 64)
+	return gid, err == nil
+}
+
+// MemoryTupleStore stores relation tuples in memory for tests.
+// Unlike TupleRepo group memberships are stored as tuples.
+type MemoryTupleStore struct {
+	mu     sync.RWMutex
+	tuples map[Tuple]struct{}
+}
+
+func NewMemoryTupleStore() *MemoryTupleStore {
+	return &MemoryTupleStore{tuples: make(map[Tuple]struct{})}
+}
+
+func (m *MemoryTupleStore) Write(tuples ...Tuple) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range tuples {
+		m.tuples[t] = struct{}{}
+	}
+
+	return nil
+}
+
+func (m *MemoryTupleStore) Delete(tuples ...Tuple) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range tuples {
+		delete(m.tuples, t)
+	}
+
+	return nil
+}
+
+func (m *MemoryTupleStore) Subjects(objectType, objectID, relation string) ([]Subject, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var subjects []Subject
+	for t := range m.tuples {
+		if t.ObjectType == objectType && t.ObjectID == objectID && t.Relation == relation {
+			subjects = append(subjects, t.Subject())
+		}
+	}
+
+	sort.Slice(subjects, func(i, j int) bool { return subjects[i].String() < subjects[j].String() })
+	return subjects, nil
+}
+
+func (m *MemoryTupleStore) Lookup(subjects ...Subject) ([]Tuple, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	lookup := make(map[Subject]bool, len(subjects))
+	for _, s := range subjects {
+		lookup[s] = true
+	}
+
+	var tuples []Tuple
+	for t := range m.tuples {
+		if lookup[t.Subject()] {
+			tuples = append(tuples, t)
+		}
+	}
+
+	return tuples, nil
+}
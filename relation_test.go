@@ -0,0 +1,246 @@
+package auth_test
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cristosal/auth"
+)
+
+func TestParseTuple(t *testing.T) {
+	tt := []struct {
+		input string
+		valid bool
+	}{
+		{"doc:1#viewer@user:1", true},
+		{"doc:1#viewer@group:5#member", true},
+		{"doc:1@user:1", false},
+		{"doc:1#viewer", false},
+		{"doc#viewer@user:1", false},
+		{"doc:1#viewer@user:", false},
+	}
+
+	for _, tc := range tt {
+		tup, err := auth.ParseTuple(tc.input)
+		if !tc.valid {
+			if !errors.Is(err, auth.ErrInvalidTuple) {
+				t.Fatalf("%s: expected invalid tuple got %v", tc.input, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: %v", tc.input, err)
+		}
+
+		if tup.String() != tc.input {
+			t.Fatalf("expected %s got %s", tc.input, tup.String())
+		}
+	}
+}
+
+func TestRelationEngine(t *testing.T) {
+	store := auth.NewMemoryTupleStore()
+	for _, s := range []string{
+		"doc:1#owner@user:1",
+		"doc:1#viewer@group:eng#member",
+		"doc:2#editor@user:2",
+		"group:eng#member@user:2",
+		"group:eng#member@group:backend#member",
+		"group:backend#member@user:3",
+		"group:a#member@group:b#member",
+		"group:b#member@group:a#member",
+	} {
+		tup, err := auth.ParseTuple(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store.Write(tup)
+	}
+
+	engine := auth.NewRelationEngine(store, auth.Namespaces{
+		"doc": {"owner": nil, "editor": {"owner"}, "viewer": {"editor"}},
+	})
+
+	tt := []struct {
+		object   string
+		relation string
+		uid      int64
+		expected bool
+	}{
+		{"1", "viewer", 1, true},
+		{"1", "editor", 1, true},
+		{"1", "owner", 2, false},
+		{"1", "viewer", 2, true},
+		{"1", "viewer", 3, true},
+		{"1", "editor", 3, false},
+		{"2", "viewer", 2, true},
+		{"2", "viewer", 3, false},
+		{"3", "viewer", 1, false},
+	}
+
+	for _, tc := range tt {
+		ok, err := engine.Check("doc", tc.object, tc.relation, auth.UserSubject(tc.uid))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok != tc.expected {
+			t.Fatalf("doc:%s#%s@user:%d: expected %v got %v", tc.object, tc.relation, tc.uid, tc.expected, ok)
+		}
+	}
+
+	if ok, err := engine.Check("group", "a", "member", auth.UserSubject(1)); err != nil || ok {
+		t.Fatalf("expected cyclic groups to terminate without membership got %v %v", ok, err)
+	}
+
+	ids, err := engine.ListObjects("doc", "viewer", auth.UserSubject(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+		t.Fatalf("expected docs 1 and 2 got %v", ids)
+	}
+
+	if ids, _ := engine.ListObjects("doc", "viewer", auth.UserSubject(3)); len(ids) != 1 || ids[0] != "1" {
+		t.Fatalf("expected doc 1 got %v", ids)
+	}
+
+	tree, err := engine.Expand("doc", "1", "viewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expanded []string
+	for _, c := range tree.Children {
+		expanded = append(expanded, c.Subject.String())
+	}
+
+	if len(expanded) != 2 || expanded[0] != "doc:1#editor" || expanded[1] != "group:eng#member" {
+		t.Fatalf("unexpected expansion %v", expanded)
+	}
+
+	if owner := tree.Children[0].Children[0]; len(owner.Subjects) != 1 || owner.Subjects[0] != auth.UserSubject(1) {
+		t.Fatalf("expected owner to be expanded under editor got %+v", owner)
+	}
+}
+
+func TestTupleRepo(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	groups := []auth.Group{
+		{Name: "tuple_engineering", Description: "engineering"},
+		{Name: "tuple_backend", Description: "backend"},
+	}
+
+	t.Cleanup(func() {
+		for i := range groups {
+			svc.Groups().Remove(groups[i].ID)
+		}
+	})
+
+	if err := svc.Groups().Seed(groups); err != nil {
+		t.Fatal(err)
+	}
+
+	parent, child := groups[0].ID, groups[1].ID
+	if err := svc.Groups().SetParent(child, &parent); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := svc.Users().Register(&auth.RegistrationRequest{Name: "Tuple User", Email: "tuple@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { svc.EraseUser(res.UserID) })
+
+	if err := svc.Groups().AddUser(res.UserID, child); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		user     = auth.UserSubject(res.UserID)
+		members  = auth.Subject{Type: auth.NamespaceGroup, ID: fmt.Sprint(parent), Relation: auth.RelationMember}
+		backend  = auth.Subject{Type: auth.NamespaceGroup, ID: fmt.Sprint(child), Relation: auth.RelationMember}
+		tuples   = []auth.Tuple{auth.NewTuple("tuple_doc", "1", "viewer", members), auth.NewTuple("tuple_doc", "2", "owner", user)}
+		store    = svc.Tuples()
+		engine   = svc.Relations(auth.Namespaces{"tuple_doc": {"owner": nil, "viewer": {"owner"}}})
+		fromUser = auth.NewTuple(auth.NamespaceGroup, fmt.Sprint(child), auth.RelationMember, user)
+	)
+
+	if err := store.Write(fromUser); !errors.Is(err, auth.ErrInvalidTuple) {
+		t.Fatalf("expected group memberships to be refused got %v", err)
+	}
+
+	if err := store.Write(tuples...); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { store.Delete(tuples...) })
+
+	subjects, err := store.Subjects(auth.NamespaceGroup, fmt.Sprint(parent), auth.RelationMember)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(subjects) != 1 || subjects[0] != backend {
+		t.Fatalf("expected subgroup as member of the parent got %v", subjects)
+	}
+
+	found, err := store.Lookup(user, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lookup []string
+	for _, tup := range found {
+		lookup = append(lookup, tup.String())
+	}
+
+	sort.Strings(lookup)
+	expected := []string{
+		auth.NewTuple(auth.NamespaceGroup, fmt.Sprint(parent), auth.RelationMember, backend).String(),
+		fromUser.String(),
+		tuples[1].String(),
+	}
+
+	sort.Strings(expected)
+	if strings.Join(lookup, " ") != strings.Join(expected, " ") {
+		t.Fatalf("expected %v got %v", expected, lookup)
+	}
+
+	if ok, err := engine.Check("tuple_doc", "1", "viewer", user); err != nil || !ok {
+		t.Fatalf("expected member of the subgroup to view doc 1 got %v %v", ok, err)
+	}
+
+	if ok, err := engine.Check("tuple_doc", "1", "owner", user); err != nil || ok {
+		t.Fatalf("expected member not to own doc 1 got %v %v", ok, err)
+	}
+
+	ids, err := engine.ListObjects("tuple_doc", "viewer", user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+		t.Fatalf("expected docs 1 and 2 got %v", ids)
+	}
+
+	if err := svc.Groups().RemoveUser(res.UserID, child); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := engine.Check("tuple_doc", "1", "viewer", user); err != nil || ok {
+		t.Fatalf("expected access to end with the membership got %v %v", ok, err)
+	}
+}
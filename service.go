@@ -12,16 +12,132 @@ type Service struct {
 	userRepo       *UserRepo
 	groupRepo      *GroupRepo
 	sessionRepo    *SessionRepo
+	phoneVerifier  *PhoneVerifier
+	eventRepo      *EventRepo
+	webhookRepo    *WebhookRepo
+	hooks          *Hooks
+	auditRepo      *AuditRepo
+	invitationRepo *InvitationRepo
+	aclRepo        *ACLRepo
+	tupleRepo      *TupleRepo
+	policyRepo     *PolicyRepo
+	quotaRepo      *QuotaRepo
 }
 
 func NewService(db orm.DB) *Service {
-	return &Service{
+	s := &Service{
 		db:             db,
 		permissionRepo: NewPermissionRepo(db),
 		groupRepo:      NewGroupRepo(db),
 		userRepo:       NewUserRepo(db),
 		sessionRepo:    NewSessionRepo(db),
+		phoneVerifier:  NewPhoneVerifier(db, nil, nil),
+		eventRepo:      NewEventRepo(db),
+		webhookRepo:    NewWebhookRepo(db),
+		hooks:          new(Hooks),
+		auditRepo:      NewAuditRepo(db),
+		aclRepo:        NewACLRepo(db),
+		tupleRepo:      NewTupleRepo(db),
+		policyRepo:     NewPolicyRepo(db),
+		quotaRepo:      NewQuotaRepo(db),
 	}
+
+	// user and group lifecycle hooks and the audit log settings are shared
+	s.userRepo.hooks = s.hooks
+	s.groupRepo.hooks = s.hooks
+	s.userRepo.audit = s.auditRepo
+	s.groupRepo.audit = s.auditRepo
+	s.aclRepo.audit = s.auditRepo
+	s.policyRepo.audit = s.auditRepo
+
+	// quotas are checked against permissions resolved with the permission strategy
+	s.quotaRepo.groups = s.groupRepo
+	s.invitationRepo = NewInvitationRepo(db, s.userRepo)
+	return s
+}
+
+// As returns a copy of the service whose user and group operations are attributed to the session in the audit log.
+// The ip and user agent of the session are recorded along with the session user.
+func (s *Service) As(sess *Session) *Service {
+	c := *s
+	c.userRepo = s.userRepo.As(sess)
+	c.groupRepo = s.groupRepo.As(sess)
+	c.invitationRepo = s.invitationRepo.As(sess)
+	c.aclRepo = s.aclRepo.As(sess)
+	c.policyRepo = s.policyRepo.As(sess)
+	return &c
+}
+
+// UsePermissionStrategy sets the strategy resolving conflicts between groups, see GroupRepo.UseStrategy
+func (s *Service) UsePermissionStrategy(strategy PermissionStrategy) {
+	s.groupRepo.UseStrategy(strategy)
+}
+
+// UseErrorHandler sets the handler receiving failures which do not fail user operations, see UserRepo.UseErrorHandler
+func (s *Service) UseErrorHandler(fn func(err error)) {
+	s.userRepo.UseErrorHandler(fn)
+}
+
+// UseLockout locks accounts after too many failed logins, see UserRepo.UseLockout
+func (s *Service) UseLockout(limiter Limiter) {
+	s.userRepo.UseLockout(limiter)
+}
+
+// UseCountryCode sets the country code prepended to phone numbers which are not in international format
+func (s *Service) UseCountryCode(code string) {
+	s.userRepo.UseCountryCode(code)
+}
+
+// UseGeoIP enables geolocation of logins for impossible travel detection
+func (s *Service) UseGeoIP(g GeoLocator) {
+	s.userRepo.UseGeoIP(g)
+}
+
+// Invitations returns the invitations api. Accept invitations with AcceptInvitation
+func (s *Service) Invitations() *InvitationRepo {
+	return s.invitationRepo
+}
+
+// ACL returns the access control lists of resources
+func (s *Service) ACL() *ACLRepo {
+	return s.aclRepo
+}
+
+// Tuples returns the relation tuples stored in postgres
+func (s *Service) Tuples() *TupleRepo {
+	return s.tupleRepo
+}
+
+// Relations returns a relation engine reading the tuples stored in postgres with the relations configured by namespaces.
+// Engines are cheap to create, create one at startup and share it.
+func (s *Service) Relations(ns Namespaces) *RelationEngine {
+	return NewRelationEngine(s.tupleRepo, ns)
+}
+
+// Policies returns the attribute based authorization policies
+func (s *Service) Policies() *PolicyRepo {
+	return s.policyRepo
+}
+
+// Quotas returns the usage ledger of quantity permissions
+func (s *Service) Quotas() *QuotaRepo {
+	return s.quotaRepo
+}
+
+// Audit returns the audit log
+func (s *Service) Audit() *AuditRepo {
+	return s.auditRepo
+}
+
+// Hooks returns the registry of user lifecycle hooks
+func (s *Service) Hooks() *Hooks {
+	return s.hooks
+}
+
+// UseSMS sets the sender used for phone verification codes.
+// Code resends and wrong guesses are rate limited by limiter, a MemoryLimiter is used when nil.
+func (s *Service) UseSMS(sender SMSSender, limiter Limiter) {
+	s.phoneVerifier = NewPhoneVerifier(s.db, sender, limiter)
 }
 
 func (s *Service) Sessions() *SessionRepo {
@@ -40,10 +156,44 @@ func (s *Service) Groups() *GroupRepo {
 	return s.groupRepo
 }
 
+// Events returns the auth events outbox
+func (s *Service) Events() *EventRepo {
+	return s.eventRepo
+}
+
+// Dispatcher returns an event dispatcher delivering outbox events to sink
+func (s *Service) Dispatcher(sink EventSink) *EventDispatcher {
+	return NewEventDispatcher(s.db, sink)
+}
+
+// Webhooks returns the webhook endpoints api.
+// Use Webhooks().Sink() as the sink of an event dispatcher to enqueue deliveries.
+func (s *Service) Webhooks() *WebhookRepo {
+	return s.webhookRepo
+}
+
+// WebhookDispatcher returns a dispatcher posting pending webhook deliveries
+func (s *Service) WebhookDispatcher() *WebhookDispatcher {
+	return NewWebhookDispatcher(s.db)
+}
+
+// UseMail enables automatic auth emails. See UserRepo.UseMail
+func (s *Service) UseMail(cfg *MailConfig) {
+	s.userRepo.UseMail(cfg)
+}
+
+func (s *Service) Phones() *PhoneVerifier {
+	return s.phoneVerifier
+}
+
 func (s *Service) Init() error {
 	if err := orm.CreateMigrationTable(s.db); err != nil {
 		return fmt.Errorf("error creating migration table: %w", err)
 	}
 
-	return orm.AddMigrations(s.db, migrations)
+	if err := orm.AddMigrations(s.db, migrations); err != nil {
+		return err
+	}
+
+	return s.userRepo.backfillCanonicalEmails()
 }
@@ -2,8 +2,10 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -27,8 +29,13 @@ type (
 		UserAgent   string           `json:"user_agent"`
 		Message     string           `json:"message"`
 		MessageType string           `json:"message_type"`
-		IP          string           `json:"ip"` // Source IP Address
+		IP          string           `json:"ip"`        // Source IP Address
+		DeviceID    string           `json:"device_id"` // Device cookie, see DeviceID
 		Meta        map[string]any   `json:"meta"`
+
+		// Impersonator is the user acting as User, see Service.Impersonate
+		Impersonator          *User  `json:"impersonator,omitempty"`
+		ImpersonatorSessionID string `json:"impersonator_session_id,omitempty"`
 	}
 )
 
@@ -88,6 +95,12 @@ func (s Session) IsAuthorized() bool {
 	return !s.IsAnonymous()
 }
 
+// IsImpersonated is true when another user is acting as the session user.
+// Applications should show this visibly, for example with a banner.
+func (s Session) IsImpersonated() bool {
+	return s.Impersonator != nil
+}
+
 func (s Session) MarshalBinary() ([]byte, error) {
 	return json.Marshal(s)
 }
@@ -96,6 +109,24 @@ func (s *Session) UnmarshalBinary(data []byte) error {
 	return json.Unmarshal(data, s)
 }
 
+// Scan implements sql.Scanner so sessions can be read from jsonb columns
+func (s *Session) Scan(src any) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, s)
+	case string:
+		return json.Unmarshal([]byte(data), s)
+	}
+
+	return fmt.Errorf("cannot scan %T into session", src)
+}
+
+// hashToken returns the hex encoded sha256 of a token, for tokens which are stored hashed
+func hashToken(tok string) string {
+	sum := sha256.Sum256([]byte(tok))
+	return hex.EncodeToString(sum[:])
+}
+
 func GenerateToken(bytes int) (string, error) {
 	buf := make([]byte, bytes)
 	_, err := rand.Read(buf)
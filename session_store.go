@@ -40,6 +40,11 @@ func (s *SessionRepo) Drop() error {
 
 // Save upserts session into database
 func (s *SessionRepo) Save(sess *Session) error {
+	return saveSession(s.db, sess)
+}
+
+// saveSession upserts the session using db
+func saveSession(db orm.Executer, sess *Session) error {
 	sess.Counter++
 
 	if sess.ID == "" {
@@ -49,14 +54,17 @@ func (s *SessionRepo) Save(sess *Session) error {
 		}
 
 		sess.ID = sid
-		return orm.Exec(s.db, "insert into sessions (id, user_id, data, expires_at) values ($1, $2, $3, $4)",
+		return orm.Exec(db, "insert into sessions (id, user_id, data, expires_at) values ($1, $2, $3, $4)",
 			sid, sess.UserID(), sess, sess.ExpiresAt)
 	}
 
-	return orm.Exec(s.db, "update sessions set updated_at = now(), data = $1, user_id = $2 where id = $3", sess, sess.UserID(), sess.ID)
+	return orm.Exec(db, "update sessions set updated_at = now(), data = $1, user_id = $2 where id = $3", sess, sess.UserID(), sess.ID)
 }
 
-// ByID returns a session by its id
+// ByID returns a session by its id.
+// Sessions of users who are not active are refused with the users status error.
+// Impersonated sessions are refused with ErrSessionNotFound once the impersonator session
+// has been removed or the impersonator is no longer active.
 func (s *SessionRepo) ByID(sessionID string) (*Session, error) {
 	var row sessionRow
 	if err := orm.Get(s.db, &row, "where id = $1", sessionID); err != nil {
@@ -67,13 +75,39 @@ func (s *SessionRepo) ByID(sessionID string) (*Session, error) {
 		return nil, err
 	}
 
+	if row.UserID != nil {
+		var u User
+		err := s.db.QueryRow("select status, suspended_until from users where id = $1", *row.UserID).Scan(&u.Status, &u.SuspendedUntil)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := u.CheckStatus(); err != nil {
+			return nil, err
+		}
+	}
+
+	if sess := &row.Data; sess.IsImpersonated() {
+		var u User
+		err := s.db.QueryRow(`select u.status, u.suspended_until from sessions s inner join users u on u.id = s.user_id
+			where s.id = $1 and s.user_id = $2`, sess.ImpersonatorSessionID, sess.Impersonator.ID).Scan(&u.Status, &u.SuspendedUntil)
+
+		if errors.Is(err, orm.ErrNotFound) || (err == nil && u.CheckStatus() != nil) {
+			return nil, ErrSessionNotFound
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &row.Data, nil
 }
 
 // ByUserID returns all sessions belonging to a user
 func (s *SessionRepo) ByUserID(uid int64) ([]Session, error) {
 	var rows []sessionRow
-	if err := orm.List(s.db, &rows, "user_id = $1", uid); err != nil {
+	if err := orm.List(s.db, &rows, "where user_id = $1", uid); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// SMSSender is the interface implemented by sms providers
+type SMSSender interface {
+	// SendSMS sends the body as a text message to a phone number in E.164 format
+	SendSMS(to, body string) error
+}
+
+// LogSMSSender writes text messages to an io.Writer instead of sending them.
+// Useful for local development and testing.
+type LogSMSSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewLogSMSSender returns an SMSSender that writes messages to w
+func NewLogSMSSender(w io.Writer) *LogSMSSender {
+	return &LogSMSSender{w: w}
+}
+
+// FileSMSSender appends text messages to a file, close it when done
+type FileSMSSender struct {
+	*LogSMSSender
+	f *os.File
+}
+
+// NewFileSMSSender returns an SMSSender that appends messages to the file at path
+func NewFileSMSSender(path string) (*FileSMSSender, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSMSSender{LogSMSSender: NewLogSMSSender(f), f: f}, nil
+}
+
+// Close closes the file
+func (s *FileSMSSender) Close() error {
+	return s.f.Close()
+}
+
+// SendSMS is the implementation of the SMSSender interface
+func (s *LogSMSSender) SendSMS(to, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.w, "%s to=%s body=%q\n", time.Now().Format(time.RFC3339), to, body)
+	return err
+}
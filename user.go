@@ -11,14 +11,21 @@ const (
 )
 
 type User struct {
-	ID          int64
-	Name        string
-	Email       string
-	Phone       string
-	Password    string `json:"-"`
-	ConfirmedAt *time.Time
-	LastLogin   *time.Time
-	CreatedAt   *time.Time
+	ID               int64
+	Name             string
+	Username         string
+	Email            string
+	Phone            string
+	Password         string `json:"-"`
+	ConfirmedAt      *time.Time
+	PhoneConfirmedAt *time.Time
+	LastLogin        *time.Time
+	CreatedAt        *time.Time
+	Status           UserStatus
+	StatusReason     string
+	SuspendedUntil   *time.Time
+	DeletedAt        *time.Time
+	Attributes       Attributes
 }
 
 func (u *User) TableName() string {
@@ -29,6 +36,11 @@ func (u *User) IsConfirmed() bool {
 	return u.ConfirmedAt != nil
 }
 
+// IsPhoneConfirmed is true when the user has verified their phone number
+func (u *User) IsPhoneConfirmed() bool {
+	return u.PhoneConfirmedAt != nil
+}
+
 func (u *User) Confirm() {
 	now := time.Now()
 	u.ConfirmedAt = &now
@@ -39,8 +51,45 @@ func (u *User) VerifyPassword(pass string) bool {
 	return err == nil
 }
 
-type UserRepo struct{ db orm.DB }
+type UserRepo struct {
+	db    orm.DB
+	mail  *MailConfig
+	hooks *Hooks
+	audit *AuditRepo
+	actor *Session
+	geo   GeoLocator
+	attrs *AttributeSchema
+
+	// searchable are attribute keys matched by Paginate, see UseSearchableAttributes
+	searchable []string
+
+	// lockout counts failed logins, see UseLockout
+	lockout Limiter
+
+	// onError receives failures of best effort work, see UseErrorHandler
+	onError func(err error)
+
+	// countryCode is prepended to phone numbers which are not in international format, see UseCountryCode
+	countryCode string
+}
 
 func NewUserRepo(db orm.DB) *UserRepo {
-	return &UserRepo{db}
+	return &UserRepo{db: db, hooks: new(Hooks)}
+}
+
+// Hooks returns the lifecycle hooks registry used by the repo
+func (r *UserRepo) Hooks() *Hooks {
+	return r.hooks
+}
+
+// As returns a copy of the repo whose actions are attributed to the session in the audit log
+func (r *UserRepo) As(sess *Session) *UserRepo {
+	c := *r
+	c.actor = sess
+	return &c
+}
+
+// auditEntry returns an entry attributed to the repo actor
+func (r *UserRepo) auditEntry(action AuditAction, target *int64, meta any) *AuditEntry {
+	return NewAuditEntry(r.actor, action, target, meta)
 }
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cristosal/orm"
+)
+
+// UseSearchableAttributes sets the attribute keys included in the text search of Paginate
+func (r *UserRepo) UseSearchableAttributes(keys ...string) {
+	r.searchable = keys
+}
+
+// UseAttributeSchema validates attributes against schema before they are stored.
+// A nil schema disables validation.
+func (r *UserRepo) UseAttributeSchema(schema *AttributeSchema) {
+	r.attrs = schema
+}
+
+// SetAttributes replaces all attributes of a user
+func (r *UserRepo) SetAttributes(uid int64, attrs Attributes) error {
+	if attrs == nil {
+		attrs = Attributes{}
+	}
+
+	if err := r.validateAttributes(attrs); err != nil {
+		return err
+	}
+
+	res, err := r.db.Exec("update users set attributes = $1 where id = $2", attrs, uid)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// UpdateAttributes merges attrs into the existing attributes of a user.
+// Keys with a nil value are removed. Returns the resulting attributes.
+func (r *UserRepo) UpdateAttributes(uid int64, attrs Attributes) (Attributes, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var merged Attributes
+	row := tx.QueryRow("select attributes from users where id = $1 for update", uid)
+	if err := row.Scan(&merged); err != nil {
+		if errors.Is(err, orm.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+
+		return nil, err
+	}
+
+	for k, v := range attrs {
+		if v == nil {
+			delete(merged, k)
+		} else {
+			merged[k] = v
+		}
+	}
+
+	if err := r.validateAttributes(merged); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("update users set attributes = $1 where id = $2", merged, uid); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+// ByAttribute returns users whose attribute key equals value
+func (r *UserRepo) ByAttribute(key string, value any) ([]User, error) {
+	filter, err := attributeFilter(key, value)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []User
+	if err := orm.List(r.db, &users, "where attributes @> $1 order by id", filter); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// PaginateAttribute paginates through users whose attribute key equals value, returning the most recent ones first
+func (r *UserRepo) PaginateAttribute(page int, key string, value any) ([]User, *orm.PaginationResults, error) {
+	filter, err := attributeFilter(key, value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var users []User
+	results, err := paginate(r.db, &users, "where attributes @> $1", []any{filter}, page, PageSize, "created_at desc")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return users, results, nil
+}
+
+func (r *UserRepo) validateAttributes(attrs Attributes) error {
+	if r.attrs == nil {
+		return nil
+	}
+
+	return r.attrs.Validate(attrs)
+}
+
+// attributeFilter returns a jsonb document matching attributes where key equals value
+func attributeFilter(key string, value any) (string, error) {
+	data, err := json.Marshal(map[string]any{key: value})
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// attributeColumn returns an sql expression selecting an attribute as text
+func attributeColumn(key string) string {
+	return fmt.Sprintf("attributes->>'%s'", strings.ReplaceAll(key, "'", "''"))
+}
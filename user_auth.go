@@ -1,29 +1,215 @@
 package auth
 
 import (
-	"database/sql"
 	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+const (
+	LockoutMaxAttempts = 5 // failed logins within LockoutWindow before the account is locked
+	LockoutWindow      = time.Minute * 15
 )
 
+// UseLockout locks accounts for LockoutWindow after LockoutMaxAttempts failed logins counted by limiter.
+// Locked accounts are refused with ErrAccountLocked and the user is sent a lockout notice when automatic emails are enabled.
+// Passing nil disables lockouts.
+func (r *UserRepo) UseLockout(limiter Limiter) {
+	r.lockout = limiter
+}
+
+// Authenticate verifies the users credentials and records the login.
+// Successful and failed attempts are recorded in the login history and audit log.
+// When the repo acts as a session (see As) the ip, user agent and device are recorded,
+// and logins from new devices or impossible locations produce events.
+// Users who are not active are refused with ErrUserSuspended, ErrUserDisabled or ErrUserDeleted,
+// and users whose account is locked with ErrAccountLocked, see UseLockout.
 func (r *UserRepo) Authenticate(email, pass string) (*User, error) {
 	u, err := r.ByEmail(email)
+	return r.authenticate(u, err, email, pass)
+}
+
+// AuthenticateIdentifier is like Authenticate but accepts either an email or a username
+func (r *UserRepo) AuthenticateIdentifier(identifier, pass string) (*User, error) {
+	u, err := r.ByIdentifier(identifier)
+	return r.authenticate(u, err, identifier, pass)
+}
 
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, ErrUnauthorized
+// authenticate verifies the password of the user found by identifier and records the login
+func (r *UserRepo) authenticate(u *User, err error, identifier, pass string) (*User, error) {
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, r.loginFailed(nil, identifier)
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
+	if r.locked(u.ID) {
+		r.loginFailed(&u.ID, identifier)
+		return nil, ErrAccountLocked
+	}
+
 	if ok := u.VerifyPassword(pass); !ok {
-		return nil, ErrUnauthorized
+		r.countFailure(u)
+		return nil, r.loginFailed(&u.ID, identifier)
+	}
+
+	// status is only revealed to users who know the password
+	if err := u.CheckStatus(); err != nil {
+		r.loginFailed(&u.ID, identifier)
+		return nil, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if err := r.hooks.beforeAuthenticate.run(tx, u); err != nil {
+		return nil, err
 	}
 
-	row := r.db.QueryRow("update users set last_login = now() where id = $1 returning last_login", u.ID)
+	row := tx.QueryRow("update users set last_login = now() where id = $1 returning last_login", u.ID)
 	if err := row.Scan(&u.LastLogin); err != nil {
 		return nil, err
 	}
 
+	// CheckStatus passed so the suspension has ended
+	if u.Status == UserSuspended {
+		if err := r.setStatusTx(tx, u.ID, UserActive, "", nil); err != nil {
+			return nil, err
+		}
+
+		u.Status = UserActive
+		u.StatusReason = ""
+		u.SuspendedUntil = nil
+	}
+
+	// imported hashes are upgraded while the plaintext is known
+	if RehashPasswords && needsRehash(u.Password) {
+		hash, err := r.PasswordHash(pass)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.Exec("update users set password = $1 where id = $2", hash, u.ID); err != nil {
+			return nil, err
+		}
+
+		u.Password = hash
+	}
+
+	if err := r.hooks.afterAuthenticate.run(tx, u); err != nil {
+		return nil, err
+	}
+
+	if err := addEvent(tx, EventUserLogin, &u.ID, map[string]any{"user_id": u.ID}); err != nil {
+		return nil, err
+	}
+
+	e := r.auditEntry(AuditLogin, &u.ID, nil)
+	e.ActorID = &u.ID
+	if err := r.audit.add(tx, e); err != nil {
+		return nil, err
+	}
+
+	attempt, err := r.recordLogin(tx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if r.lockout != nil {
+		if err := r.lockout.Reset(lockoutKey(u.ID)); err != nil {
+			r.reportError(fmt.Errorf("resetting lockout: %w", err))
+		}
+	}
+
+	// new device notices are best effort, the outbox event is the reliable record
+	if attempt.NewDevice {
+		r.Notify(MailNewDevice, u, &MailData{IP: attempt.IP, UserAgent: attempt.UserAgent})
+	}
+
 	return u, nil
 }
+
+func lockoutKey(uid int64) string {
+	return fmt.Sprintf("lockout:%d", uid)
+}
+
+// UseErrorHandler sets the handler receiving failures of best effort work which do not fail the operation,
+// such as recording failed logins or counting them towards a lockout. When nil such failures are ignored.
+func (r *UserRepo) UseErrorHandler(fn func(err error)) {
+	r.onError = fn
+}
+
+func (r *UserRepo) reportError(err error) {
+	if r.onError != nil {
+		r.onError(err)
+	}
+}
+
+// locked is true when the account of the user is locked, see UseLockout
+func (r *UserRepo) locked(uid int64) bool {
+	return r.lockout != nil && r.lockout.TTL(lockoutKey(uid), LockoutMaxAttempts) > 0
+}
+
+// countFailure counts a failed login towards the lockout of the user.
+// The user is notified when the failure locks the account.
+func (r *UserRepo) countFailure(u *User) {
+	if r.lockout == nil {
+		return
+	}
+
+	key := lockoutKey(u.ID)
+	if err := r.lockout.Limit(key, LockoutMaxAttempts, LockoutWindow); err != nil {
+		if !errors.Is(err, ErrLimitReached) {
+			r.reportError(fmt.Errorf("counting failed login: %w", err))
+		}
+
+		return
+	}
+
+	if ttl := r.lockout.TTL(key, LockoutMaxAttempts); ttl > 0 {
+		until := time.Now().Add(ttl)
+		r.deliver(MailLockout, u.Name, u.Email, &MailData{Until: &until})
+	}
+}
+
+// loginFailed records a failed login attempt with the email or username used.
+// It always returns ErrUnauthorized, failures to record the attempt are passed to the error handler.
+func (r *UserRepo) loginFailed(uid *int64, identifier string) error {
+	if err := r.recordLoginFailure(uid, identifier); err != nil {
+		r.reportError(fmt.Errorf("recording failed login: %w", err))
+	}
+
+	return ErrUnauthorized
+}
+
+func (r *UserRepo) recordLoginFailure(uid *int64, identifier string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := orm.Add(tx, r.newLoginAttempt(uid, identifier, false)); err != nil {
+		return err
+	}
+
+	e := r.auditEntry(AuditLoginFailed, uid, map[string]any{"identifier": identifier})
+	if err := r.audit.add(tx, e); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
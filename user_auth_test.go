@@ -0,0 +1,44 @@
+package auth_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cristosal/auth"
+)
+
+func TestLockout(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	mailer := auth.NewMemoryMailer()
+	svc.UseMail(&auth.MailConfig{Mailer: mailer, From: "no-reply@example.com", AppName: "Acme"})
+	svc.UseLockout(auth.NewMemoryLimiter())
+
+	email := "lockout@example.com"
+	res, err := svc.Users().Register(&auth.RegistrationRequest{Name: "Lockout", Email: email, Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { svc.EraseUser(res.UserID) })
+
+	mailer.Reset()
+	for i := 0; i < auth.LockoutMaxAttempts; i++ {
+		if _, err := svc.Users().Authenticate(email, "wrong"); !errors.Is(err, auth.ErrUnauthorized) {
+			t.Fatalf("attempt %d: expected unauthorized got %v", i, err)
+		}
+	}
+
+	if _, err := svc.Users().Authenticate(email, "password123"); !errors.Is(err, auth.ErrAccountLocked) {
+		t.Fatalf("expected locked account got %v", err)
+	}
+
+	msgs := mailer.Messages()
+	if len(msgs) != 1 || msgs[0].To != email || !strings.Contains(msgs[0].Subject, "locked") {
+		t.Fatalf("expected a single lockout notice got %+v", msgs)
+	}
+}
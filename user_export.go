@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+// EachBatchSize is the number of users fetched from the cursor at a time by Each and Export
+const EachBatchSize = 500
+
+// ExportOptions change which users and fields are exported
+type ExportOptions struct {
+	Query               *UserQuery // filters users, sorting and limits are ignored
+	IncludePasswordHash bool       // include password hashes for migrating to another system
+}
+
+// Each calls fn for every user matching the query in order of id.
+// Users are read through a server side cursor so memory use does not grow with the number of users.
+// Sorting, limits and cursors of the query are ignored. Iteration stops at the first error returned by fn.
+func (r *UserRepo) Each(ctx context.Context, q *UserQuery, fn func(*User) error) error {
+	return r.eachBatch(ctx, q, func(_ orm.Querier, users []User) error {
+		for i := range users {
+			if err := fn(&users[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// eachBatch calls fn with batches of users read from a server side cursor within a read only transaction
+func (r *UserRepo) eachBatch(ctx context.Context, q *UserQuery, fn func(orm.Querier, []User) error) error {
+	if q == nil {
+		q = &UserQuery{}
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("set transaction read only"); err != nil {
+		return err
+	}
+
+	where, args := q.where()
+	cols := orm.Columns(&User{}).List()
+	sql := fmt.Sprintf("declare users_cursor no scroll cursor for select %s from users %s order by id", cols, where)
+	if _, err := tx.Exec(sql, args...); err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf("fetch forward %d from users_cursor", EachBatchSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var users []User
+		if err := orm.Query(tx, &users, fetch); err != nil {
+			return err
+		}
+
+		if len(users) == 0 {
+			break
+		}
+
+		if err := fn(tx, users); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Export writes users as csv or json lines along with their group names, confirmation status and last login.
+// Files written by Export can be read by Import. Returns the number of users exported.
+func (r *UserRepo) Export(ctx context.Context, w io.Writer, format UserFormat, opts *ExportOptions) (int, error) {
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+
+	var write func(*UserRecord) error
+	var flush func() error
+
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader(opts.IncludePasswordHash)); err != nil {
+			return 0, err
+		}
+
+		write = func(rec *UserRecord) error {
+			return cw.Write(rec.csvRow(opts.IncludePasswordHash))
+		}
+
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		write = func(rec *UserRecord) error { return enc.Encode(rec) }
+		flush = func() error { return nil }
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+
+	count := 0
+	err := r.eachBatch(ctx, opts.Query, func(tx orm.Querier, users []User) error {
+		groups, err := userGroupNames(tx, users)
+		if err != nil {
+			return err
+		}
+
+		for i := range users {
+			u := &users[i]
+			if err := write(newUserRecord(u, groups[u.ID], opts.IncludePasswordHash)); err != nil {
+				return err
+			}
+		}
+
+		count += len(users)
+		return flush()
+	})
+
+	if err != nil {
+		return count, err
+	}
+
+	meta := map[string]any{"count": count, "format": format, "password_hash": opts.IncludePasswordHash}
+	return count, NewAuditRepo(r.db).Add(r.auditEntry(AuditUsersExported, nil, meta))
+}
+
+// userGroupNames returns the names of the groups of each user ordered by name
+func userGroupNames(db orm.Querier, users []User) (map[int64][]string, error) {
+	ids := make([]int64, len(users))
+	for i := range users {
+		ids[i] = users[i].ID
+	}
+
+	rows, err := db.Query(`select gu.user_id, g.name from group_users gu
+		inner join groups g on g.id = gu.group_id
+		where gu.user_id = any($1) order by g.name`, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	groups := make(map[int64][]string)
+	for rows.Next() {
+		var (
+			uid  int64
+			name string
+		)
+
+		if err := rows.Scan(&uid, &name); err != nil {
+			return nil, err
+		}
+
+		groups[uid] = append(groups[uid], name)
+	}
+
+	return groups, rows.Err()
+}
+
+func newUserRecord(u *User, groups []string, includeHash bool) *UserRecord {
+	rec := UserRecord{
+		ID:          u.ID,
+		Name:        u.Name,
+		Username:    u.Username,
+		Email:       u.Email,
+		Phone:       u.Phone,
+		Confirmed:   u.IsConfirmed(),
+		ConfirmedAt: u.ConfirmedAt,
+		Groups:      groups,
+		LastLogin:   u.LastLogin,
+		CreatedAt:   u.CreatedAt,
+		Status:      u.Status,
+	}
+
+	if includeHash {
+		rec.PasswordHash = u.Password
+	}
+
+	return &rec
+}
+
+func csvHeader(includeHash bool) []string {
+	header := []string{"id", "name", "username", "email", "phone", "confirmed", "confirmed_at", "last_login", "created_at", "status", "groups"}
+	if includeHash {
+		header = append(header, "password_hash")
+	}
+
+	return header
+}
+
+func (rec *UserRecord) csvRow(includeHash bool) []string {
+	row := []string{
+		strconv.FormatInt(rec.ID, 10),
+		rec.Name,
+		rec.Username,
+		rec.Email,
+		rec.Phone,
+		strconv.FormatBool(rec.Confirmed),
+		formatCSVTime(rec.ConfirmedAt),
+		formatCSVTime(rec.LastLogin),
+		formatCSVTime(rec.CreatedAt),
+		string(rec.Status),
+		strings.Join(rec.Groups, GroupSeparator),
+	}
+
+	if includeHash {
+		row = append(row, rec.PasswordHash)
+	}
+
+	return row
+}
+
+func formatCSVTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339Nano)
+}
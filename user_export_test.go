@@ -0,0 +1,57 @@
+package auth_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/cristosal/auth"
+)
+
+func TestExportRecordImportable(t *testing.T) {
+	confirmed := time.Date(2023, 5, 1, 12, 30, 0, 0, time.UTC)
+	u := auth.User{
+		ID:          7,
+		Name:        "Alice",
+		Username:    "alice",
+		Email:       "alice@example.com",
+		Password:    "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy",
+		ConfirmedAt: &confirmed,
+		Status:      auth.UserActive,
+	}
+
+	var buf bytes.Buffer
+	auth.WriteCSVRecord(&buf, auth.NewUserRecord(&u, []string{"admins", "staff"}, true), true)
+
+	next, err := auth.NewRecordReader(&buf, auth.FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, rec, err := next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Email != u.Email || rec.Username != u.Username || rec.PasswordHash != u.Password {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+
+	if !rec.Confirmed || rec.ConfirmedAt == nil || !rec.ConfirmedAt.Equal(confirmed) {
+		t.Fatalf("expected confirmation to be kept got %v %v", rec.Confirmed, rec.ConfirmedAt)
+	}
+
+	if len(rec.Groups) != 2 || rec.Groups[0] != "admins" {
+		t.Fatalf("unexpected groups %v", rec.Groups)
+	}
+
+	if _, _, err := next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected eof got %v", err)
+	}
+
+	if rec := auth.NewUserRecord(&u, nil, false); rec.PasswordHash != "" {
+		t.Fatal("expected password hash to be excluded")
+	}
+}
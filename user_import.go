@@ -0,0 +1,708 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cristosal/orm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// UserFormat is a file format for importing and exporting users
+type UserFormat string
+
+const (
+	FormatCSV   UserFormat = "csv"   // header row followed by one user per row
+	FormatJSONL UserFormat = "jsonl" // one json object per line
+)
+
+const (
+	// GroupSeparator separates group names in the groups column of csv files
+	GroupSeparator = ";"
+
+	// ImportBatchSize is the default number of users imported per transaction
+	ImportBatchSize = 1000
+)
+
+// UserRecord is a user as it appears in import and export files.
+// Csv columns are named after the json fields.
+// The id, last login, creation time and status are only exported and are ignored on import.
+type UserRecord struct {
+	ID           int64      `json:"id,omitempty"`
+	Name         string     `json:"name"`
+	Username     string     `json:"username,omitempty"`
+	Email        string     `json:"email"`
+	Phone        string     `json:"phone,omitempty"`
+	Password     string     `json:"password,omitempty"`      // plaintext, hashed on import
+	PasswordHash string     `json:"password_hash,omitempty"` // see IsPasswordHash for supported formats
+	Confirmed    bool       `json:"confirmed"`
+	ConfirmedAt  *time.Time `json:"confirmed_at,omitempty"`
+	Groups       []string   `json:"groups,omitempty"`
+	LastLogin    *time.Time `json:"last_login,omitempty"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+	Status       UserStatus `json:"status,omitempty"`
+}
+
+// ImportOptions change how users are imported
+type ImportOptions struct {
+	Confirm      bool // mark all imported users as confirmed
+	CreateGroups bool // create groups which do not exist instead of rejecting the row
+	BatchSize    int  // users per transaction, defaults to ImportBatchSize
+}
+
+// ImportError is a row which could not be imported
+type ImportError struct {
+	Row   int // starting at 1 for the first user
+	Email string
+	Err   error
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// ImportReport summarizes an import
+type ImportReport struct {
+	Rows     int
+	Imported int
+	Errors   []ImportError
+}
+
+// importRow is a validated record ready to be inserted
+type importRow struct {
+	row         int
+	rec         *UserRecord
+	email       string
+	canonical   string
+	username    string
+	phone       string
+	hash        string
+	confirmedAt *time.Time
+}
+
+// Import streams users from a csv or json lines reader, see ImportWithOptions
+func (r *UserRepo) Import(rd io.Reader, format UserFormat) (*ImportReport, error) {
+	return r.ImportWithOptions(rd, format, nil)
+}
+
+// ImportWithOptions streams users from a csv or json lines reader and inserts them in batches.
+// Passwords may be given in plaintext or as an existing bcrypt, argon2 or PBKDF2 hash,
+// groups are assigned by name and users are confirmed when the record or options say so.
+// Rows which can not be imported, such as duplicate emails, are collected in the report
+// while the remaining rows are imported. An error is only returned when reading or writing fails.
+func (r *UserRepo) ImportWithOptions(rd io.Reader, format UserFormat, opts *ImportOptions) (*ImportReport, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+
+	size := opts.BatchSize
+	if size <= 0 {
+		size = ImportBatchSize
+	}
+
+	next, err := newRecordReader(rd, format)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		report ImportReport
+		batch  []*importRow
+	)
+
+	for {
+		row, rec, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var ierr *ImportError
+		if errors.As(err, &ierr) {
+			report.Rows++
+			report.Errors = append(report.Errors, *ierr)
+			continue
+		}
+
+		if err != nil {
+			return &report, err
+		}
+
+		report.Rows++
+
+		ir, err := r.prepareImport(row, rec, opts)
+		if err != nil {
+			report.Errors = append(report.Errors, ImportError{Row: row, Email: rec.Email, Err: err})
+			continue
+		}
+
+		batch = append(batch, ir)
+		if len(batch) >= size {
+			if err := r.importBatch(batch, opts, &report); err != nil {
+				return &report, err
+			}
+
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := r.importBatch(batch, opts, &report); err != nil {
+			return &report, err
+		}
+	}
+
+	return &report, nil
+}
+
+// prepareImport validates and normalizes a record.
+// Plaintext passwords are hashed later for the whole batch.
+func (r *UserRepo) prepareImport(row int, rec *UserRecord, opts *ImportOptions) (*importRow, error) {
+	rec.Name = strings.TrimSpace(rec.Name)
+	if rec.Name == "" {
+		return nil, ErrNameRequired
+	}
+
+	if strings.TrimSpace(rec.Email) == "" {
+		return nil, ErrEmailRequired
+	}
+
+	email, err := NormalizeEmail(rec.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	ir := importRow{row: row, rec: rec, email: email, canonical: CanonicalEmail(email)}
+
+	if strings.TrimSpace(rec.Username) != "" {
+		if ir.username, err = NormalizeUsername(rec.Username); err != nil {
+			return nil, err
+		}
+	}
+
+	if strings.TrimSpace(rec.Phone) != "" {
+		if ir.phone, err = NormalizePhoneWithCountry(rec.Phone, r.countryCode); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case rec.PasswordHash != "":
+		if !IsPasswordHash(rec.PasswordHash) {
+			return nil, ErrUnsupportedHash
+		}
+
+		ir.hash = rec.PasswordHash
+	case rec.Password == "":
+		return nil, ErrPasswordRequired
+	}
+
+	switch {
+	case rec.ConfirmedAt != nil:
+		ir.confirmedAt = rec.ConfirmedAt
+	case rec.Confirmed || opts.Confirm:
+		now := time.Now()
+		ir.confirmedAt = &now
+	}
+
+	return &ir, nil
+}
+
+// importBatch inserts a batch of rows in one transaction, reporting rows which conflict with existing users
+func (r *UserRepo) importBatch(batch []*importRow, opts *ImportOptions, report *ImportReport) error {
+	if err := r.hashPasswords(batch); err != nil {
+		return err
+	}
+
+	fail := func(ir *importRow, err error) {
+		report.Errors = append(report.Errors, ImportError{Row: ir.row, Email: ir.rec.Email, Err: err})
+	}
+
+	rows, err := r.filterImport(batch, opts, fail)
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+
+	tx, done, err := r.importTx(rows)
+	if err != nil {
+		return err
+	}
+
+	defer done()
+
+	if opts.CreateGroups {
+		_, err := tx.Exec(`insert into groups (name, description)
+			select distinct unnest(groups), '' from user_imports on conflict do nothing`)
+		if err != nil {
+			return err
+		}
+	}
+
+	res, err := tx.Query(`insert into users (name, username, email, email_canonical, phone, password, confirmed_at)
+		select name, username, email, email_canonical, phone, password, confirmed_at from user_imports order by row
+		on conflict do nothing returning email`)
+	if err != nil {
+		return err
+	}
+
+	inserted := make(map[string]bool, len(rows))
+	for res.Next() {
+		var email string
+		if err := res.Scan(&email); err != nil {
+			res.Close()
+			return err
+		}
+
+		inserted[email] = true
+	}
+
+	if err := res.Err(); err != nil {
+		return err
+	}
+
+	// rows taken concurrently since filtering are not assigned to groups
+	var emails []string
+	for _, ir := range rows {
+		if inserted[ir.email] {
+			emails = append(emails, ir.email)
+		} else {
+			fail(ir, ErrUserExists)
+		}
+	}
+
+	_, err = tx.Exec(`insert into group_users (user_id, group_id)
+		select u.id, g.id from user_imports s
+		join users u on u.email = s.email::citext
+		join groups g on g.name = any(s.groups)
+		where s.email = any($1)
+		on conflict do nothing`, emails)
+	if err != nil {
+		return err
+	}
+
+	if err := r.audit.add(tx, r.auditEntry(AuditUsersImported, nil, map[string]any{"count": len(emails)})); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	report.Imported += len(emails)
+	return nil
+}
+
+// filterImport removes rows which duplicate each other or existing users, or refer to unknown groups
+func (r *UserRepo) filterImport(batch []*importRow, opts *ImportOptions, fail func(*importRow, error)) ([]*importRow, error) {
+	var (
+		emails     []string
+		canonicals []string
+		usernames  []string
+		groups     []string
+	)
+
+	for _, ir := range batch {
+		emails = append(emails, ir.email)
+		canonicals = append(canonicals, ir.canonical)
+		if ir.username != "" {
+			usernames = append(usernames, strings.ToLower(ir.username))
+		}
+
+		groups = append(groups, ir.rec.Groups...)
+	}
+
+	takenEmails, err := queryStrings(r.db, "select lower(email) from users where email = any($1::citext[])", emails)
+	if err != nil {
+		return nil, err
+	}
+
+	takenUsernames, err := queryStrings(r.db, "select lower(username) from users where username <> '' and lower(username) = any($1)", usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	takenCanonicals := make(map[string]bool)
+	if RejectCanonicalDuplicates {
+		if takenCanonicals, err = queryStrings(r.db, "select email_canonical from users where email_canonical = any($1)", canonicals); err != nil {
+			return nil, err
+		}
+	}
+
+	knownGroups := make(map[string]bool)
+	if !opts.CreateGroups {
+		if knownGroups, err = queryStrings(r.db, "select name from groups where name = any($1)", groups); err != nil {
+			return nil, err
+		}
+	}
+
+	var rows []*importRow
+	for _, ir := range batch {
+		username := strings.ToLower(ir.username)
+
+		switch {
+		case takenEmails[ir.email], RejectCanonicalDuplicates && takenCanonicals[ir.canonical]:
+			fail(ir, ErrUserExists)
+			continue
+		case username != "" && takenUsernames[username]:
+			fail(ir, ErrUsernameTaken)
+			continue
+		}
+
+		if missing := missingGroup(ir.rec.Groups, knownGroups, opts.CreateGroups); missing != "" {
+			fail(ir, fmt.Errorf("%w: %s", ErrGroupNotFound, missing))
+			continue
+		}
+
+		// later rows of the file conflict with earlier ones
+		takenEmails[ir.email] = true
+		takenCanonicals[ir.canonical] = true
+		if username != "" {
+			takenUsernames[username] = true
+		}
+
+		rows = append(rows, ir)
+	}
+
+	return rows, nil
+}
+
+func missingGroup(groups []string, known map[string]bool, create bool) string {
+	if create {
+		return ""
+	}
+
+	for _, g := range groups {
+		if !known[g] {
+			return g
+		}
+	}
+
+	return ""
+}
+
+// hashPasswords hashes plaintext passwords of the batch in parallel
+func (r *UserRepo) hashPasswords(batch []*importRow) error {
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		err   error
+		queue = make(chan *importRow)
+	)
+
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ir := range queue {
+				hash, herr := r.PasswordHash(ir.rec.Password)
+				if herr != nil {
+					once.Do(func() { err = herr })
+					continue
+				}
+
+				ir.hash = hash
+			}
+		}()
+	}
+
+	for _, ir := range batch {
+		if ir.hash == "" {
+			queue <- ir
+		}
+	}
+
+	close(queue)
+	wg.Wait()
+	return err
+}
+
+// importTx begins a transaction with the rows staged in the user_imports temporary table.
+// Rows are staged with COPY when the database is a *sql.DB using the pgx driver,
+// otherwise they are inserted within the transaction.
+// The returned function must be called once the transaction is no longer used.
+func (r *UserRepo) importTx(rows []*importRow) (*sql.Tx, func(), error) {
+	if db, ok := r.db.(*sql.DB); ok {
+		ctx := context.Background()
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		copied, err := copyImportRows(ctx, conn, rows)
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+
+		if copied {
+			tx, err := conn.BeginTx(ctx, nil)
+			if err != nil {
+				conn.ExecContext(ctx, "drop table if exists user_imports")
+				conn.Close()
+				return nil, nil, err
+			}
+
+			return tx, func() {
+				tx.Rollback()
+				conn.ExecContext(ctx, "drop table if exists user_imports")
+				conn.Close()
+			}, nil
+		}
+
+		conn.Close()
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	done := func() { tx.Rollback() }
+	if _, err := tx.Exec(createImportTable + " on commit drop"); err != nil {
+		done()
+		return nil, nil, err
+	}
+
+	// stay well below the limit of 65535 parameters per statement
+	const chunk = 500
+	for start := 0; start < len(rows); start += chunk {
+		end := start + chunk
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		var (
+			values []string
+			args   []any
+		)
+
+		for _, ir := range rows[start:end] {
+			n := len(args)
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9))
+			args = append(args, ir.values()...)
+		}
+
+		sql := fmt.Sprintf("insert into user_imports (%s) values %s", strings.Join(importColumns, ", "), strings.Join(values, ", "))
+		if _, err := tx.Exec(sql, args...); err != nil {
+			done()
+			return nil, nil, err
+		}
+	}
+
+	return tx, done, nil
+}
+
+const createImportTable = `create temporary table user_imports (
+	row int not null,
+	name text not null,
+	username text not null,
+	email text not null,
+	email_canonical text not null,
+	phone text not null,
+	password text not null,
+	confirmed_at timestamptz,
+	groups text[] not null
+)`
+
+var importColumns = []string{"row", "name", "username", "email", "email_canonical", "phone", "password", "confirmed_at", "groups"}
+
+func (ir *importRow) values() []any {
+	groups := ir.rec.Groups
+	if groups == nil {
+		groups = []string{}
+	}
+
+	return []any{ir.row, ir.rec.Name, ir.username, ir.email, ir.canonical, ir.phone, ir.hash, ir.confirmedAt, groups}
+}
+
+// copyImportRows stages the rows with COPY, returning false when the connection does not use pgx
+func copyImportRows(ctx context.Context, conn *sql.Conn, rows []*importRow) (bool, error) {
+	copied := false
+	err := conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return nil
+		}
+
+		pc := c.Conn()
+		if _, err := pc.Exec(ctx, "drop table if exists user_imports"); err != nil {
+			return err
+		}
+
+		if _, err := pc.Exec(ctx, createImportTable); err != nil {
+			return err
+		}
+
+		_, err := pc.CopyFrom(ctx, pgx.Identifier{"user_imports"}, importColumns, pgx.CopyFromSlice(len(rows), func(i int) ([]any, error) {
+			return rows[i].values(), nil
+		}))
+
+		copied = err == nil
+		return err
+	})
+
+	return copied, err
+}
+
+// queryStrings returns the set of strings selected by a query with a single array argument
+func queryStrings(db orm.Querier, sql string, arg []string) (map[string]bool, error) {
+	set := make(map[string]bool)
+	if len(arg) == 0 {
+		return set, nil
+	}
+
+	rows, err := db.Query(sql, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+
+		set[s] = true
+	}
+
+	return set, rows.Err()
+}
+
+// newRecordReader returns a function reading the next record and its row number.
+// Malformed rows are returned as an *ImportError and io.EOF is returned at the end.
+func newRecordReader(rd io.Reader, format UserFormat) (func() (int, *UserRecord, error), error) {
+	switch format {
+	case FormatCSV:
+		return newCSVRecordReader(rd)
+	case FormatJSONL:
+		return newJSONLRecordReader(rd), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+}
+
+func newCSVRecordReader(rd io.Reader) (func() (int, *UserRecord, error), error) {
+	cr := csv.NewReader(rd)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make(map[string]int, len(header))
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+
+	if _, ok := cols["email"]; !ok {
+		return nil, fmt.Errorf("%w: missing email column", ErrUnsupportedFormat)
+	}
+
+	row := 0
+	return func() (int, *UserRecord, error) {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return 0, nil, io.EOF
+		}
+
+		row++
+
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			return row, nil, &ImportError{Row: row, Err: err}
+		}
+
+		if err != nil {
+			return row, nil, err
+		}
+
+		get := func(col string) string {
+			if i, ok := cols[col]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+
+			return ""
+		}
+
+		rec := UserRecord{
+			Name:         get("name"),
+			Username:     get("username"),
+			Email:        get("email"),
+			Phone:        get("phone"),
+			Password:     get("password"),
+			PasswordHash: get("password_hash"),
+		}
+
+		if v := get("confirmed"); v != "" {
+			if rec.Confirmed, err = strconv.ParseBool(v); err != nil {
+				return row, nil, &ImportError{Row: row, Email: rec.Email, Err: fmt.Errorf("invalid confirmed value %q", v)}
+			}
+		}
+
+		if v := get("confirmed_at"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return row, nil, &ImportError{Row: row, Email: rec.Email, Err: fmt.Errorf("invalid confirmed_at value %q", v)}
+			}
+
+			rec.ConfirmedAt = &t
+		}
+
+		for _, g := range strings.Split(get("groups"), GroupSeparator) {
+			if g = strings.TrimSpace(g); g != "" {
+				rec.Groups = append(rec.Groups, g)
+			}
+		}
+
+		return row, &rec, nil
+	}, nil
+}
+
+func newJSONLRecordReader(rd io.Reader) func() (int, *UserRecord, error) {
+	sc := bufio.NewScanner(rd)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	row := 0
+	return func() (int, *UserRecord, error) {
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" {
+				continue
+			}
+
+			row++
+
+			var rec UserRecord
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				return row, nil, &ImportError{Row: row, Err: err}
+			}
+
+			return row, &rec, nil
+		}
+
+		if err := sc.Err(); err != nil {
+			return row, nil, err
+		}
+
+		return 0, nil, io.EOF
+	}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestImportRecordReaders(t *testing.T) {
+	csv := "email,name,password_hash,confirmed,groups,unknown\n" +
+		"a@example.com,Alice,$2a$10$abc,true,admins; staff,x\n" +
+		"b@example.com,Bob,,nope,,\n"
+
+	jsonl := `{"email": "a@example.com", "name": "Alice", "password_hash": "$2a$10$abc", "confirmed": true, "groups": ["admins", "staff"]}
+
+{"email": "b@example.com", "name": `
+
+	for format, input := range map[UserFormat]string{FormatCSV: csv, FormatJSONL: jsonl} {
+		next, err := newRecordReader(strings.NewReader(input), format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		row, rec, err := next()
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		if row != 1 || rec.Email != "a@example.com" || rec.PasswordHash != "$2a$10$abc" || !rec.Confirmed {
+			t.Fatalf("%s: unexpected record %d %+v", format, row, rec)
+		}
+
+		if len(rec.Groups) != 2 || rec.Groups[1] != "staff" {
+			t.Fatalf("%s: unexpected groups %v", format, rec.Groups)
+		}
+
+		var ierr *ImportError
+		if row, _, err = next(); !errors.As(err, &ierr) || row != 2 {
+			t.Fatalf("%s: expected import error on row 2 got %d %v", format, row, err)
+		}
+
+		if _, _, err := next(); !errors.Is(err, io.EOF) {
+			t.Fatalf("%s: expected eof got %v", format, err)
+		}
+	}
+
+	if _, err := newRecordReader(strings.NewReader("name\nalice\n"), FormatCSV); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("expected missing email column to be unsupported got %v", err)
+	}
+}
+
+func TestPrepareImport(t *testing.T) {
+	tt := []struct {
+		rec UserRecord
+		err error
+	}{
+		{UserRecord{Name: "Alice", Email: "Alice@Example.com", Password: "secret"}, nil},
+		{UserRecord{Name: "Alice", Email: "alice@example.com", PasswordHash: "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"}, nil},
+		{UserRecord{Email: "alice@example.com", Password: "secret"}, ErrNameRequired},
+		{UserRecord{Name: "Alice", Email: "alice", Password: "secret"}, ErrInvalidEmail},
+		{UserRecord{Name: "Alice", Email: "alice@example.com"}, ErrPasswordRequired},
+		{UserRecord{Name: "Alice", Email: "alice@example.com", PasswordHash: "md5$abc"}, ErrUnsupportedHash},
+		{UserRecord{Name: "Alice", Email: "alice@example.com", PasswordHash: "$argon2id$v=19$m=4294967295,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5"}, ErrUnsupportedHash},
+		{UserRecord{Name: "Alice", Email: "alice@example.com", PasswordHash: "$argon2id$v=19$m=65536,t=1,p=257$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5"}, ErrUnsupportedHash},
+		{UserRecord{Name: "Alice", Email: "alice@example.com", PasswordHash: "pbkdf2_sha256$100000000$saltsalt$aGFzaA=="}, ErrUnsupportedHash},
+		{UserRecord{Name: "Alice", Email: "alice@example.com", Password: "secret", Username: "admin"}, ErrUsernameReserved},
+	}
+
+	for i, tc := range tt {
+		ir, err := new(UserRepo).prepareImport(i+1, &tc.rec, &ImportOptions{Confirm: true})
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("%d: expected %v got %v", i, tc.err, err)
+		}
+
+		if err == nil && (ir.email != "alice@example.com" || ir.confirmedAt == nil) {
+			t.Fatalf("%d: unexpected row %+v", i, ir)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package auth
+
+import "fmt"
+
+// MailConfig enables sending auth emails automatically from UserRepo methods
+type MailConfig struct {
+	Mailer    Mailer
+	Templates *MailTemplates // defaults to NewMailTemplates()
+	From      string
+	AppName   string
+	Locale    string
+
+	// Link builds the action url included in emails for the given token.
+	// When nil the token is included in the email instead.
+	Link func(kind MailKind, token string) string
+
+	// OnError is called when an email sent alongside another operation fails,
+	// the operation itself succeeds. When nil the error is passed to the error handler of the repo, see UserRepo.UseErrorHandler.
+	OnError func(kind MailKind, email string, err error)
+}
+
+// UseMail enables automatic emails.
+// Register and RenewRegistration send confirmation emails,
+// RequestPasswordReset sends password reset emails and
+// UpdateInfo notifies the previous address when the email changes and
+// Authenticate sends lockout notices, see UseLockout.
+// Passing nil disables automatic emails.
+func (r *UserRepo) UseMail(cfg *MailConfig) {
+	if cfg != nil && cfg.Templates == nil {
+		cfg.Templates = NewMailTemplates()
+	}
+
+	r.mail = cfg
+}
+
+// Notify renders and sends an email of the given kind to the user.
+// It is a noop when automatic emails are disabled.
+func (r *UserRepo) Notify(kind MailKind, u *User, data *MailData) error {
+	if r.mail == nil {
+		return nil
+	}
+
+	if data == nil {
+		data = new(MailData)
+	}
+
+	return r.sendMail(kind, u.Name, u.Email, data)
+}
+
+// deliver sends the email reporting failures to OnError instead of the caller
+func (r *UserRepo) deliver(kind MailKind, name, email string, data *MailData) {
+	err := r.sendMail(kind, name, email, data)
+	if err == nil {
+		return
+	}
+
+	if r.mail.OnError != nil {
+		r.mail.OnError(kind, email, err)
+		return
+	}
+
+	r.reportError(fmt.Errorf("sending %s email: %w", kind, err))
+}
+
+func (r *UserRepo) sendMail(kind MailKind, name, email string, data *MailData) error {
+	if r.mail == nil {
+		return nil
+	}
+
+	cfg := r.mail
+
+	if data.AppName == "" {
+		data.AppName = cfg.AppName
+	}
+
+	if data.Locale == "" {
+		data.Locale = cfg.Locale
+	}
+
+	if data.Name == "" {
+		data.Name = name
+	}
+
+	if data.Email == "" {
+		data.Email = email
+	}
+
+	if data.URL == "" && data.Token != "" && cfg.Link != nil {
+		data.URL = cfg.Link(kind, data.Token)
+	}
+
+	m, err := cfg.Templates.Render(kind, data)
+	if err != nil {
+		return err
+	}
+
+	m.From = cfg.From
+	m.To = email
+	return cfg.Mailer.Send(m)
+}
@@ -29,6 +29,9 @@ func (PasswordResetToken) TableName() string {
 	return "pass_tokens"
 }
 
+// RequestPasswordReset generates a password reset token for the user with the given email.
+// When automatic emails are enabled a password reset email is sent,
+// failures are reported to MailConfig.OnError and do not fail the request.
 func (r *UserRepo) RequestPasswordReset(email string) (*PasswordResetToken, error) {
 	var (
 		id   int64
@@ -36,8 +39,8 @@ func (r *UserRepo) RequestPasswordReset(email string) (*PasswordResetToken, erro
 	)
 
 	// check if user exists.
-	row := r.db.QueryRow("select id, name from users where email = $1", email)
-	if err := row.Scan(&id, &name); err != nil {
+	row := r.db.QueryRow("select id, name, email from users where email = $1", r.SanitizeEmail(email))
+	if err := row.Scan(&id, &name, &email); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
 		}
@@ -72,10 +75,15 @@ func (r *UserRepo) RequestPasswordReset(email string) (*PasswordResetToken, erro
 		return nil, err
 	}
 
+	if err := r.audit.add(tx, r.auditEntry(AuditPasswordResetRequested, &id, nil)); err != nil {
+		return nil, err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 
+	r.deliver(MailPasswordReset, name, email, &MailData{Token: token})
 	return &t, nil
 }
 
@@ -107,13 +115,21 @@ func (r *UserRepo) ConfirmPasswordReset(reset *PasswordReset) (*User, error) {
 		return nil, ErrTokenExpired
 	}
 
+	var u User
+	if err := orm.Get(tx, &u, "where id = $1", uid); err != nil {
+		return nil, err
+	}
+
+	if err := r.hooks.beforePasswordReset.run(tx, &u); err != nil {
+		return nil, err
+	}
+
 	// hash the new password
 	password, err := r.PasswordHash(reset.Password)
 	if err != nil {
 		return nil, err
 	}
 
-	var u User
 	cols := schema.MustGet(&u).Fields.Columns().List()
 	err = orm.QueryRow(tx, &u, fmt.Sprintf("update users set password = $1 where id = $2 returning %s", cols), password, uid)
 	if err != nil {
@@ -126,6 +142,18 @@ func (r *UserRepo) ConfirmPasswordReset(reset *PasswordReset) (*User, error) {
 		return nil, err
 	}
 
+	if err := r.hooks.afterPasswordReset.run(tx, &u); err != nil {
+		return nil, err
+	}
+
+	if err := addEvent(tx, EventPasswordReset, &uid, map[string]any{"user_id": uid}); err != nil {
+		return nil, err
+	}
+
+	if err := r.audit.add(tx, r.auditEntry(AuditPasswordReset, &uid, nil)); err != nil {
+		return nil, err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
@@ -152,7 +180,3 @@ func (UserRepo) PasswordHash(pass string) (string, error) {
 
 	return string(str), err
 }
-
-func verifyHash(hash string, pass string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass))
-}
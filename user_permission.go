@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+// UserPermission grants or denies a permission to a single user, overriding the permissions of their groups
+type UserPermission struct {
+	UserID       int64
+	PermissionID int64
+	Name         string `db:"-"` // permission name
+	Value        int
+	Deny         bool
+	ExpiresAt    *time.Time // the entry is ignored after this time, nil never expires
+	CreatedAt    time.Time  `db:"created_at,ro"`
+}
+
+func (*UserPermission) TableName() string {
+	return "user_permissions"
+}
+
+// GrantPermission grants a permission with a value to the user, replacing any previous grant or denial.
+// A nil expiry grants the permission indefinitely.
+func (r *UserRepo) GrantPermission(uid, pid int64, value int, expires *time.Time) error {
+	return r.setPermission(&UserPermission{UserID: uid, PermissionID: pid, Value: value, ExpiresAt: expires})
+}
+
+// DenyPermission denies a permission to the user regardless of their groups, replacing any previous grant.
+// A nil expiry denies the permission indefinitely.
+func (r *UserRepo) DenyPermission(uid, pid int64, expires *time.Time) error {
+	return r.setPermission(&UserPermission{UserID: uid, PermissionID: pid, Deny: true, ExpiresAt: expires})
+}
+
+func (r *UserRepo) setPermission(up *UserPermission) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`insert into user_permissions (user_id, permission_id, value, deny, expires_at) values ($1, $2, $3, $4, $5)
+		on conflict (user_id, permission_id) do update set value = excluded.value, deny = excluded.deny, expires_at = excluded.expires_at`,
+		up.UserID, up.PermissionID, up.Value, up.Deny, up.ExpiresAt)
+
+	if isForeignKeyViolation(err, "user_permissions_user_id_fkey") {
+		return ErrUserNotFound
+	}
+
+	if isForeignKeyViolation(err, "user_permissions_permission_id_fkey") {
+		return ErrPermissionNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]any{"user_id": up.UserID, "permission_id": up.PermissionID, "value": up.Value, "deny": up.Deny, "expires_at": up.ExpiresAt}
+	if err := addEvent(tx, EventUserPermissionSet, &up.UserID, payload); err != nil {
+		return err
+	}
+
+	if err := r.audit.add(tx, r.auditEntry(AuditUserPermissionSet, &up.UserID, payload)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemovePermission removes a grant or denial of a permission from the user.
+// The user keeps any permission granted through their groups.
+func (r *UserRepo) RemovePermission(uid, pid int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	res, err := tx.Exec("delete from user_permissions where user_id = $1 and permission_id = $2", uid, pid)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	payload := map[string]any{"user_id": uid, "permission_id": pid}
+	if err := addEvent(tx, EventUserPermissionRemoved, &uid, payload); err != nil {
+		return err
+	}
+
+	if err := r.audit.add(tx, r.auditEntry(AuditUserPermissionRemoved, &uid, payload)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Permissions returns the permissions granted or denied to the user directly, including expired ones
+func (r *UserRepo) Permissions(uid int64) ([]UserPermission, error) {
+	cols := orm.Columns(&UserPermission{}).PrefixedList("up")
+	sql := "select " + cols + ", p.name from user_permissions up inner join permissions p on p.id = up.permission_id where up.user_id = $1 order by p.name"
+
+	rows, err := r.db.Query(sql, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var perms []UserPermission
+	for rows.Next() {
+		var up UserPermission
+		if err := rows.Scan(&up.UserID, &up.PermissionID, &up.Value, &up.Deny, &up.ExpiresAt, &up.CreatedAt, &up.Name); err != nil {
+			return nil, err
+		}
+
+		perms = append(perms, up)
+	}
+
+	return perms, rows.Err()
+}
+
+// ExplainPermission resolves a permission of the user across their groups and direct grants and shows which source won
+func (s *Service) ExplainPermission(uid int64, name string) (*PermissionExplanation, error) {
+	perms, err := s.groupRepo.userPermissionEntries(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return perms.ExplainWith(name, s.groupRepo.Strategy()), nil
+}
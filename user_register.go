@@ -14,6 +14,7 @@ const TokenDuration = time.Hour
 type (
 	RegistrationRequest struct {
 		Name     string
+		Username string // optional
 		Email    string
 		Phone    string
 		Password string
@@ -27,11 +28,12 @@ type (
 	}
 
 	RegistrationResponse struct {
-		UserID int64
-		Name   string
-		Email  string
-		Phone  string
-		Token  string
+		UserID   int64
+		Name     string
+		Username string
+		Email    string
+		Phone    string
+		Token    string
 	}
 )
 
@@ -39,12 +41,39 @@ func (RegistrationToken) TableName() string {
 	return "registration_tokens"
 }
 
+// Register creates an unconfirmed user along with a registration token.
+// When automatic emails are enabled a confirmation email is sent,
+// failures are reported to MailConfig.OnError and do not fail the registration.
 func (r *UserRepo) Register(req *RegistrationRequest) (*RegistrationResponse, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	res, err := r.register(tx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	r.deliver(MailConfirmation, res.Name, res.Email, &MailData{Token: res.Token})
+	return res, nil
+}
+
+// register creates a user within the transaction.
+// Confirmed users are created without a registration token.
+func (r *UserRepo) register(tx orm.QuerierExecuter, req *RegistrationRequest, confirmed bool) (*RegistrationResponse, error) {
 	var (
-		name  = req.Name
-		email = req.Email
-		phone = req.Phone
-		pass  = req.Password
+		name     = req.Name
+		username = req.Username
+		email    = req.Email
+		phone    = req.Phone
+		pass     = req.Password
 	)
 
 	// sanitize values
@@ -52,6 +81,26 @@ func (r *UserRepo) Register(req *RegistrationRequest) (*RegistrationResponse, er
 	email = r.SanitizeEmail(email)
 	phone = strings.Trim(phone, " ")
 
+	if phone != "" {
+		normalized, err := NormalizePhoneWithCountry(phone, r.countryCode)
+		if err != nil {
+			return nil, err
+		}
+
+		phone = normalized
+	}
+
+	if strings.TrimSpace(username) != "" {
+		normalized, err := NormalizeUsername(username)
+		if err != nil {
+			return nil, err
+		}
+
+		username = normalized
+	} else {
+		username = ""
+	}
+
 	if name == "" {
 		return nil, ErrNameRequired
 	}
@@ -60,11 +109,15 @@ func (r *UserRepo) Register(req *RegistrationRequest) (*RegistrationResponse, er
 		return nil, ErrEmailRequired
 	}
 
+	if _, err := NormalizeEmail(email); err != nil {
+		return nil, err
+	}
+
 	if pass == "" {
 		return nil, ErrPasswordRequired
 	}
 
-	row := r.db.QueryRow("select email from users where email = $1", email)
+	row := tx.QueryRow("select email from users where email = $1", email)
 
 	var found string
 
@@ -74,45 +127,91 @@ func (r *UserRepo) Register(req *RegistrationRequest) (*RegistrationResponse, er
 		return nil, ErrUserExists
 	}
 
-	newpass, err := r.PasswordHash(pass)
-	if err != nil {
-		return nil, err
+	canonical := CanonicalEmail(email)
+	if RejectCanonicalDuplicates {
+		row = tx.QueryRow("select exists (select 1 from users where email_canonical = $1)", canonical)
+
+		var exists bool
+		if err := row.Scan(&exists); err != nil {
+			return nil, err
+		}
+
+		if exists {
+			return nil, ErrUserExists
+		}
 	}
 
-	tok, err := GenerateToken(16)
+	if username != "" {
+		if taken, err := r.usernameTaken(tx, username, 0); err != nil {
+			return nil, err
+		} else if taken {
+			return nil, ErrUsernameTaken
+		}
+	}
+
+	newpass, err := r.PasswordHash(pass)
 	if err != nil {
 		return nil, err
 	}
 
-	tx, err := r.db.Begin()
-	if err != nil {
+	// hooks receive a sanitized copy of the request without the password
+	sanitized := RegistrationRequest{Name: name, Username: username, Email: email, Phone: phone}
+	if err := r.hooks.beforeRegister.run(tx, &sanitized); err != nil {
 		return nil, err
 	}
 
-	defer tx.Rollback()
+	var confirmedAt *time.Time
+	if confirmed {
+		now := time.Now()
+		confirmedAt = &now
+	}
 
-	row = tx.QueryRow("insert into users (name, email, password, phone) values ($1, $2, $3, $4) returning id", name, email, newpass, phone)
+	row = tx.QueryRow("insert into users (name, username, email, email_canonical, password, phone, confirmed_at) values ($1, $2, $3, $4, $5, $6, $7) returning id",
+		name, username, email, canonical, newpass, phone, confirmedAt)
 
 	var uid int64
 	if err = row.Scan(&uid); err != nil {
+		if isUniqueViolation(err, "users_username_idx") {
+			err = ErrUsernameTaken
+		}
+
 		return nil, err
 	}
 
-	_, err = tx.Exec("insert into registration_tokens (user_id, email, token, expires) values ($1, $2, $3, $4)", uid, email, tok, time.Now().Add(TokenDuration))
+	var tok string
+	if !confirmed {
+		if tok, err = GenerateToken(16); err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec("insert into registration_tokens (user_id, email, token, expires) values ($1, $2, $3, $4)", uid, email, tok, time.Now().Add(TokenDuration))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = addEvent(tx, EventUserRegistered, &uid, map[string]any{"user_id": uid, "name": name, "username": username})
 	if err != nil {
 		return nil, err
 	}
 
-	if err = tx.Commit(); err != nil {
-		return nil, err
+	if confirmed {
+		if err := addEvent(tx, EventUserConfirmed, &uid, map[string]any{"user_id": uid}); err != nil {
+			return nil, err
+		}
 	}
 
 	res := RegistrationResponse{
-		UserID: uid,
-		Name:   name,
-		Email:  email,
-		Phone:  phone,
-		Token:  tok,
+		UserID:   uid,
+		Name:     name,
+		Username: username,
+		Email:    email,
+		Phone:    phone,
+		Token:    tok,
+	}
+
+	if err := r.hooks.afterRegister.run(tx, &res); err != nil {
+		return nil, err
 	}
 
 	return &res, nil
@@ -146,8 +245,17 @@ func (r *UserRepo) ConfirmRegistration(tok string) (*User, error) {
 		return nil, ErrTokenExpired
 	}
 
-	_, err = tx.Exec("update users set confirmed_at = $1 where id = $2", time.Now(), uid)
-	if err != nil {
+	var u User
+	if err := orm.Get(tx, &u, "where id = $1", uid); err != nil {
+		return nil, err
+	}
+
+	if err := r.hooks.beforeConfirmRegistration.run(tx, &u); err != nil {
+		return nil, err
+	}
+
+	row = tx.QueryRow("update users set confirmed_at = $1 where id = $2 returning confirmed_at", time.Now(), uid)
+	if err := row.Scan(&u.ConfirmedAt); err != nil {
 		return nil, err
 	}
 
@@ -156,8 +264,11 @@ func (r *UserRepo) ConfirmRegistration(tok string) (*User, error) {
 		return nil, err
 	}
 
-	var u User
-	if err := orm.Get(tx, &u, "where id = $1", uid); err != nil {
+	if err := r.hooks.afterConfirmRegistration.run(tx, &u); err != nil {
+		return nil, err
+	}
+
+	if err := addEvent(tx, EventUserConfirmed, &uid, map[string]any{"user_id": uid}); err != nil {
 		return nil, err
 	}
 
@@ -170,7 +281,9 @@ func (r *UserRepo) ConfirmRegistration(tok string) (*User, error) {
 
 // RenewRegistration generates another registration token for the given user.
 // Returns ErrTokenNotFound if a registration token was not available.
-// To issue a renewal, a token must have already been generated
+// To issue a renewal, a token must have already been generated.
+// When automatic emails are enabled a confirmation email is sent,
+// failures are reported to MailConfig.OnError.
 func (r *UserRepo) RenewRegistration(uid int64) (*RegistrationToken, error) {
 	var t RegistrationToken
 	if err := orm.Get(r.db, &t, "where user_id = $1", uid); err != nil {
@@ -193,5 +306,14 @@ func (r *UserRepo) RenewRegistration(uid int64) (*RegistrationToken, error) {
 		return nil, err
 	}
 
+	if r.mail != nil {
+		u, err := r.ByID(uid)
+		if err != nil {
+			return nil, err
+		}
+
+		r.deliver(MailConfirmation, u.Name, u.Email, &MailData{Token: tok})
+	}
+
 	return &t, nil
 }
@@ -27,7 +27,7 @@ func TestRegister(t *testing.T) {
 	req := &auth.RegistrationRequest{
 		Name:     "pepe       ",
 		Email:    " pepito@gmail.com   ",
-		Phone:    "hello world",
+		Phone:    "+1 (415) 555-0100",
 		Password: "  123 ",
 	}
 
@@ -49,6 +49,10 @@ func TestRegister(t *testing.T) {
 		t.Fatal("expected email to be sanitized")
 	}
 
+	if reg.Phone != "+14155550100" {
+		t.Fatal("expected phone to be normalized")
+	}
+
 	if reg.Token == "" {
 		t.Fatal("expected token to be present")
 	}
@@ -64,3 +68,57 @@ func TestRegister(t *testing.T) {
 	}
 
 }
+
+func TestUpdateInfoDuplicateEmail(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	var uids []int64
+	for _, email := range []string{"update-first@example.com", "update-second@example.com"} {
+		res, err := svc.Users().Register(&auth.RegistrationRequest{Name: "Update", Email: email, Password: "password123"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		uids = append(uids, res.UserID)
+	}
+
+	t.Cleanup(func() {
+		for _, uid := range uids {
+			svc.EraseUser(uid)
+		}
+	})
+
+	u, err := svc.Users().ByID(uids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u.Email = "Update-First@example.com"
+	if err := svc.Users().UpdateInfo(u); !errors.Is(err, auth.ErrUserExists) {
+		t.Fatalf("expected user exists got %v", err)
+	}
+
+	u.Email = "update-second@example.com"
+	if err := svc.Users().UpdateInfo(u); err != nil {
+		t.Fatalf("expected keeping the email to succeed got %v", err)
+	}
+}
+
+func TestMakeEmailsCaseInsensitive(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	collisions, err := svc.Users().MakeEmailsCaseInsensitive()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(collisions) != 0 {
+		t.Fatalf("expected emails to be case insensitive after init got collisions %v", collisions)
+	}
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"strings"
@@ -8,12 +9,18 @@ import (
 	"github.com/cristosal/orm"
 )
 
-// Paginate paginates through users returning the most recent ones first
+// Paginate paginates through users returning the most recent ones first.
+// The query matches name, email, phone and any of the searchable attributes, see UseSearchableAttributes.
 func (r *UserRepo) Paginate(page int, q string) ([]User, *orm.PaginationResults, error) {
+	cols := []string{"name", "email", "phone"}
+	for _, key := range r.searchable {
+		cols = append(cols, attributeColumn(key))
+	}
+
 	var users []User
 	results, err := orm.Paginate(r.db, &users, &orm.PaginationOptions{
 		Query:         q,
-		QueryColumns:  []string{"name", "email", "phone"},
+		QueryColumns:  cols,
 		Page:          page,
 		PageSize:      PageSize,
 		SortBy:        "created_at",
@@ -40,8 +47,15 @@ func (r *UserRepo) ByID(id int64) (*User, error) {
 	return &u, nil
 }
 
-// ByGroup returns a slice of users belonging to a group
-func (r *UserRepo) ByGroup(gid int64) ([]User, error) {
+// ByGroup returns a slice of users belonging to a group.
+// Members of subgroups are only included when IncludeSubgroups is passed as scope.
+func (r *UserRepo) ByGroup(gid int64, scope ...MemberScope) ([]User, error) {
+	for _, sc := range scope {
+		if sc == IncludeSubgroups {
+			return r.byGroupTree(gid)
+		}
+	}
+
 	var u User
 	cols := orm.Columns(u).PrefixedList("u")
 	sql := fmt.Sprintf("select %s from %s u inner join group_users gu on gu.user_id = u.id where gu.group_id = $1", cols, u.TableName())
@@ -66,11 +80,215 @@ func (r *UserRepo) ByEmail(email string) (*User, error) {
 	return &u, nil
 }
 
-// UpdateInfo updates the users info, excluding the password
+// UseCountryCode sets the country code prepended to phone numbers which are not in international format.
+// When empty, phone numbers must start with + or 00.
+func (r *UserRepo) UseCountryCode(code string) {
+	r.countryCode = code
+}
+
+// UpdateInfo updates the users info, excluding the password.
+// Returns ErrUserNotFound when the user does not exist.
+// The email is normalized and returns ErrInvalidEmail when malformed.
+// Returns ErrUserExists when another user has the email, or its canonical form when RejectCanonicalDuplicates is set.
+// The phone number is normalized and its confirmation is cleared when it changes.
+// When automatic emails are enabled the previous address is notified of an email change.
 func (r *UserRepo) UpdateInfo(u *User) error {
-	return orm.Exec(r.db, "update users set name = $1, email = $2, phone = $3 where id = $4", u.Name, u.Email, u.Phone, u.ID)
+	email, err := NormalizeEmail(u.Email)
+	if err != nil {
+		return err
+	}
+
+	u.Email = email
+
+	if u.Phone != "" {
+		phone, err := NormalizePhoneWithCountry(u.Phone, r.countryCode)
+		if err != nil {
+			return err
+		}
+
+		u.Phone = phone
+	}
+
+	canonical := CanonicalEmail(u.Email)
+	if taken, err := r.emailTaken(u.Email, canonical, u.ID); err != nil {
+		return err
+	} else if taken {
+		return ErrUserExists
+	}
+
+	row := r.db.QueryRow(`update users set
+			name = $1,
+			email = $2,
+			email_canonical = $5,
+			phone_confirmed_at = case when users.phone = $3 then users.phone_confirmed_at else null end,
+			phone = $3
+		from (select email from users where id = $4) prev
+		where users.id = $4 returning prev.email, users.phone_confirmed_at`, u.Name, u.Email, u.Phone, u.ID, canonical)
+
+	var prev string
+	if err := row.Scan(&prev, &u.PhoneConfirmedAt); err != nil {
+		if errors.Is(err, orm.ErrNotFound) {
+			return ErrUserNotFound
+		}
+
+		if isUniqueViolation(err, "users_email_key") {
+			return ErrUserExists
+		}
+
+		return err
+	}
+
+	// the email has changed, failures to notify the previous address are reported to OnError
+	if prev != u.Email {
+		r.deliver(MailEmailChange, u.Name, prev, &MailData{NewEmail: u.Email})
+	}
+
+	return nil
+}
+
+// emailTaken reports whether a user other than uid has the email,
+// or the canonical email when RejectCanonicalDuplicates is set
+func (r *UserRepo) emailTaken(email, canonical string, uid int64) (bool, error) {
+	var taken bool
+	row := r.db.QueryRow("select exists (select 1 from users where (email = $1 or ($2 and email_canonical = $3)) and id <> $4)",
+		email, RejectCanonicalDuplicates, canonical, uid)
+
+	if err := row.Scan(&taken); err != nil {
+		return false, err
+	}
+
+	return taken, nil
 }
 
+// SanitizeEmail normalizes the email as NormalizeEmail does.
+// Malformed addresses are only trimmed and lowercased.
 func (UserRepo) SanitizeEmail(email string) string {
-	return strings.ToLower(strings.Trim(email, " "))
+	normalized, err := NormalizeEmail(email)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(email))
+	}
+
+	return normalized
+}
+
+// EmailCollision is a set of users whose emails share a canonical form
+type EmailCollision struct {
+	Canonical string
+	UserIDs   []int64
+	Emails    []string
+}
+
+// EmailCollisions returns users whose emails are equal after canonicalization, see CanonicalEmail
+func (r *UserRepo) EmailCollisions() ([]EmailCollision, error) {
+	rows, err := r.db.Query(`select id, email, email_canonical from users
+		where email_canonical in (select email_canonical from users group by email_canonical having count(*) > 1)
+		order by email_canonical, id`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanEmailCollisions(rows)
+}
+
+// scanEmailCollisions groups rows of id, email and shared form ordered by the shared form
+func scanEmailCollisions(rows *sql.Rows) ([]EmailCollision, error) {
+	var collisions []EmailCollision
+	for rows.Next() {
+		var (
+			id               int64
+			email, canonical string
+		)
+
+		if err := rows.Scan(&id, &email, &canonical); err != nil {
+			return nil, err
+		}
+
+		if n := len(collisions); n == 0 || collisions[n-1].Canonical != canonical {
+			collisions = append(collisions, EmailCollision{Canonical: canonical})
+		}
+
+		c := &collisions[len(collisions)-1]
+		c.UserIDs = append(c.UserIDs, id)
+		c.Emails = append(c.Emails, email)
+	}
+
+	return collisions, rows.Err()
+}
+
+// canonicalBatchSize is the number of users updated per statement when filling in canonical emails
+const canonicalBatchSize = 1000
+
+// backfillCanonicalEmails fills in missing canonical emails using CanonicalEmail in batches of users
+func (r *UserRepo) backfillCanonicalEmails() error {
+	var lastID int64
+	for {
+		rows, err := r.db.Query("select id, email from users where email_canonical = '' and id > $1 order by id limit $2", lastID, canonicalBatchSize)
+		if err != nil {
+			return err
+		}
+
+		var (
+			ids        []int64
+			canonicals []string
+		)
+
+		for rows.Next() {
+			var email string
+			if err := rows.Scan(&lastID, &email); err != nil {
+				rows.Close()
+				return err
+			}
+
+			ids = append(ids, lastID)
+			canonicals = append(canonicals, CanonicalEmail(email))
+		}
+
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		err = orm.Exec(r.db, `update users u set email_canonical = v.canonical
+			from unnest($1::int[], $2::text[]) as v (id, canonical) where u.id = v.id`, ids, canonicals)
+		if err != nil {
+			return err
+		}
+
+		if len(ids) < canonicalBatchSize {
+			return nil
+		}
+	}
+}
+
+// MakeEmailsCaseInsensitive makes the email column case insensitive.
+// This is done by Init unless emails differing only in case exist,
+// in which case they are returned and the column is left unchanged until the users are merged.
+func (r *UserRepo) MakeEmailsCaseInsensitive() ([]EmailCollision, error) {
+	var typ string
+	row := r.db.QueryRow("select udt_name from information_schema.columns where table_schema = current_schema() and table_name = 'users' and column_name = 'email'")
+	if err := row.Scan(&typ); err != nil || typ == "citext" {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`select id, email, lower(email) from users
+		where lower(email) in (select lower(email) from users group by lower(email) having count(*) > 1)
+		order by lower(email), id`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	collisions, err := scanEmailCollisions(rows)
+	if err != nil || len(collisions) > 0 {
+		return collisions, err
+	}
+
+	return nil, orm.Exec(r.db, "alter table users alter column email type citext")
 }
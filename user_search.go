@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+// UserSortField is a field users can be sorted by in a search
+type UserSortField string
+
+const (
+	SortByID        UserSortField = "id"
+	SortByName      UserSortField = "name"
+	SortByEmail     UserSortField = "email"
+	SortByCreatedAt UserSortField = "created_at"
+	SortByLastLogin UserSortField = "last_login"
+)
+
+// MaxSearchLimit is the maximum number of users returned by a single search
+const MaxSearchLimit = 1000
+
+// sortExpressions are the sql expressions for each sort field.
+// Nullable columns are coalesced so that they can be compared in a cursor.
+var sortExpressions = map[UserSortField]string{
+	SortByID:        "id",
+	SortByName:      "name",
+	SortByEmail:     "email",
+	SortByCreatedAt: "created_at",
+	SortByLastLogin: "coalesce(last_login, '0001-01-01 00:00:00+00')",
+}
+
+// UserQuery filters and sorts users in a search. Zero values do not filter.
+type UserQuery struct {
+	Text            string       // matches name, username, email or phone
+	Confirmed       *bool        // confirmed or unconfirmed users
+	Status          []UserStatus // any of the statuses
+	GroupIDs        []int64      // members of any of the groups
+	CreatedAfter    *time.Time
+	CreatedBefore   *time.Time
+	LastLoginAfter  *time.Time
+	LastLoginBefore *time.Time
+	SortBy          UserSortField // defaults to SortByCreatedAt
+	Desc            bool
+	Limit           int    // defaults to PageSize
+	Cursor          string // NextCursor of the previous results
+	Count           bool   // include the total number of matching users
+}
+
+// UserSearchResults is a page of users matching a query
+type UserSearchResults struct {
+	Users      []User
+	NextCursor string // empty on the last page
+	Total      *int64 // only set when requested with UserQuery.Count
+}
+
+// userCursor is the position of the last user of a page
+type userCursor struct {
+	SortBy UserSortField `json:"s"`
+	Desc   bool          `json:"d"`
+	Value  any           `json:"v"`
+	ID     int64         `json:"i"`
+}
+
+// Search returns users matching the query using keyset pagination,
+// which stays fast regardless of how deep the page is.
+// Pass the NextCursor of the results in the query to fetch the next page.
+func (r *UserRepo) Search(q *UserQuery) (*UserSearchResults, error) {
+	if q == nil {
+		q = &UserQuery{}
+	}
+
+	var res UserSearchResults
+	if q.Count {
+		where, args := q.where()
+		total, err := orm.Count(r.db, &User{}, where, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Total = &total
+	}
+
+	sql, args, err := q.build()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := orm.List(r.db, &res.Users, sql, args...); err != nil {
+		return nil, err
+	}
+
+	if limit := q.limit(); len(res.Users) > limit {
+		res.Users = res.Users[:limit]
+		res.NextCursor = q.cursor(&res.Users[limit-1])
+	}
+
+	return &res, nil
+}
+
+func (q *UserQuery) limit() int {
+	if q.Limit <= 0 {
+		return PageSize
+	}
+
+	if q.Limit > MaxSearchLimit {
+		return MaxSearchLimit
+	}
+
+	return q.Limit
+}
+
+func (q *UserQuery) sortBy() (UserSortField, error) {
+	if q.SortBy == "" {
+		return SortByCreatedAt, nil
+	}
+
+	if _, ok := sortExpressions[q.SortBy]; !ok {
+		return "", fmt.Errorf("%w: cannot sort by %s", ErrInvalidQuery, q.SortBy)
+	}
+
+	return q.SortBy, nil
+}
+
+// where returns the filters of the query without the cursor
+func (q *UserQuery) where() (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if q.Text != "" {
+		add("(name ilike $%[1]d or username ilike $%[1]d or email ilike $%[1]d or phone ilike $%[1]d)", "%"+escapeLike(q.Text)+"%")
+	}
+
+	if q.Confirmed != nil {
+		if *q.Confirmed {
+			conds = append(conds, "confirmed_at is not null")
+		} else {
+			conds = append(conds, "confirmed_at is null")
+		}
+	}
+
+	if len(q.Status) > 0 {
+		statuses := make([]string, len(q.Status))
+		for i, s := range q.Status {
+			statuses[i] = string(s)
+		}
+
+		add("status = any($%d)", statuses)
+	}
+
+	if len(q.GroupIDs) > 0 {
+		add("exists (select 1 from group_users gu where gu.user_id = users.id and gu.group_id = any($%d))", q.GroupIDs)
+	}
+
+	if q.CreatedAfter != nil {
+		add("created_at >= $%d", *q.CreatedAfter)
+	}
+
+	if q.CreatedBefore != nil {
+		add("created_at < $%d", *q.CreatedBefore)
+	}
+
+	if q.LastLoginAfter != nil {
+		add("last_login >= $%d", *q.LastLoginAfter)
+	}
+
+	if q.LastLoginBefore != nil {
+		add("last_login < $%d", *q.LastLoginBefore)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+
+	return "where " + strings.Join(conds, " and "), args
+}
+
+// build returns the where, order and limit clauses of the query including the cursor.
+// One more row than the limit is fetched to know whether there is a next page.
+func (q *UserQuery) build() (string, []any, error) {
+	sortBy, err := q.sortBy()
+	if err != nil {
+		return "", nil, err
+	}
+
+	where, args := q.where()
+	expr := sortExpressions[sortBy]
+	op, dir := ">", "asc"
+	if q.Desc {
+		op, dir = "<", "desc"
+	}
+
+	if q.Cursor != "" {
+		c, err := decodeUserCursor(q.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if c.SortBy != sortBy || c.Desc != q.Desc {
+			return "", nil, ErrInvalidCursor
+		}
+
+		args = append(args, c.Value, c.ID)
+		cond := fmt.Sprintf("(%s, id) %s ($%d, $%d)", expr, op, len(args)-1, len(args))
+		if where == "" {
+			where = "where " + cond
+		} else {
+			where += " and " + cond
+		}
+	}
+
+	sql := fmt.Sprintf("%s order by %s %s, id %s limit %d", where, expr, dir, dir, q.limit()+1)
+	return strings.TrimSpace(sql), args, nil
+}
+
+// cursor returns the cursor positioned after u
+func (q *UserQuery) cursor(u *User) string {
+	sortBy, _ := q.sortBy()
+	c := userCursor{SortBy: sortBy, Desc: q.Desc, ID: u.ID}
+
+	switch sortBy {
+	case SortByID:
+		c.Value = u.ID
+	case SortByName:
+		c.Value = u.Name
+	case SortByEmail:
+		c.Value = u.Email
+	case SortByCreatedAt:
+		if u.CreatedAt != nil {
+			c.Value = u.CreatedAt.UTC().Format(time.RFC3339Nano)
+		}
+	case SortByLastLogin:
+		var t time.Time
+		if u.LastLogin != nil {
+			t = *u.LastLogin
+		}
+
+		c.Value = t.UTC().Format(time.RFC3339Nano)
+	}
+
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeUserCursor(s string) (*userCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+
+	var c userCursor
+	if err := dec.Decode(&c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	switch v := c.Value.(type) {
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+
+		c.Value = n
+	case string:
+		if c.SortBy == SortByCreatedAt || c.SortBy == SortByLastLogin {
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, ErrInvalidCursor
+			}
+
+			c.Value = t
+		}
+	default:
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// escapeLike escapes the wildcard characters of a like pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
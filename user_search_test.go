@@ -0,0 +1,94 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cristosal/auth"
+)
+
+func TestUserQueryBuild(t *testing.T) {
+	confirmed := true
+	after := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	q := &auth.UserQuery{
+		Text:         "50%",
+		Confirmed:    &confirmed,
+		Status:       []auth.UserStatus{auth.UserActive, auth.UserSuspended},
+		GroupIDs:     []int64{1, 2},
+		CreatedAfter: &after,
+		SortBy:       auth.SortByName,
+		Desc:         true,
+		Limit:        10,
+	}
+
+	sql, args, err := q.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "where (name ilike $1 or username ilike $1 or email ilike $1 or phone ilike $1) and confirmed_at is not null and status = any($2) and exists (select 1 from group_users gu where gu.user_id = users.id and gu.group_id = any($3)) and created_at >= $4 order by name desc, id desc limit 11"
+	if sql != expected {
+		t.Fatalf("unexpected sql:\n%s\nexpected:\n%s", sql, expected)
+	}
+
+	if len(args) != 4 || args[0] != `%50\%%` {
+		t.Fatalf("unexpected args %v", args)
+	}
+}
+
+func TestUserQueryCursor(t *testing.T) {
+	created := time.Date(2023, 5, 1, 12, 30, 0, 123, time.UTC)
+	q := &auth.UserQuery{SortBy: auth.SortByCreatedAt}
+	q.Cursor = q.CursorFor(&auth.User{ID: 42, CreatedAt: &created})
+
+	sql, args, err := q.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "where (created_at, id) > ($1, $2) order by created_at asc, id asc limit 26"
+	if sql != expected {
+		t.Fatalf("unexpected sql:\n%s\nexpected:\n%s", sql, expected)
+	}
+
+	if v, ok := args[0].(time.Time); !ok || !v.Equal(created) {
+		t.Fatalf("expected cursor time %v got %v", created, args[0])
+	}
+
+	if args[1] != int64(42) {
+		t.Fatalf("expected cursor id 42 got %v", args[1])
+	}
+
+	// cursors can not be reused with a different sort
+	q.Desc = true
+	if _, _, err := q.Build(); !errors.Is(err, auth.ErrInvalidCursor) {
+		t.Fatalf("expected invalid cursor got %v", err)
+	}
+
+	q = &auth.UserQuery{Cursor: "not a cursor"}
+	if _, _, err := q.Build(); !errors.Is(err, auth.ErrInvalidCursor) {
+		t.Fatalf("expected invalid cursor got %v", err)
+	}
+
+	q = &auth.UserQuery{SortBy: "password"}
+	if _, _, err := q.Build(); !errors.Is(err, auth.ErrInvalidQuery) {
+		t.Fatalf("expected invalid query got %v", err)
+	}
+}
+
+func TestUserQueryCursorLastLogin(t *testing.T) {
+	q := &auth.UserQuery{SortBy: auth.SortByLastLogin, Desc: true}
+	q.Cursor = q.CursorFor(&auth.User{ID: 7})
+
+	_, args, err := q.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// users who never logged in are positioned at the zero time
+	if v, ok := args[0].(time.Time); !ok || !v.IsZero() {
+		t.Fatalf("expected zero time got %v", args[0])
+	}
+}
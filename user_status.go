@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+type UserStatus string
+
+const (
+	UserActive    UserStatus = "active"
+	UserSuspended UserStatus = "suspended"
+	UserDisabled  UserStatus = "disabled"
+	UserDeleted   UserStatus = "deleted"
+)
+
+// DeletedUserRetention is the time soft deleted users are kept before being anonymized
+var DeletedUserRetention = time.Hour * 24 * 30
+
+// CheckStatus returns an error when the user is not allowed to login.
+// Suspended users become active once their suspension has ended,
+// their status is set back to active on their next login.
+func (u *User) CheckStatus() error {
+	switch u.Status {
+	case UserSuspended:
+		if u.SuspendedUntil != nil && u.SuspendedUntil.Before(time.Now()) {
+			return nil
+		}
+
+		return ErrUserSuspended
+	case UserDisabled:
+		return ErrUserDisabled
+	case UserDeleted:
+		return ErrUserDeleted
+	}
+
+	return nil
+}
+
+// IsActive is true when the user is allowed to login
+func (u *User) IsActive() bool {
+	return u.CheckStatus() == nil
+}
+
+// Suspend blocks the user from logging in until the given time and revokes their sessions
+func (r *UserRepo) Suspend(uid int64, until time.Time, reason string) error {
+	return r.setStatus(uid, UserSuspended, reason, &until)
+}
+
+// Disable blocks the user from logging in indefinitely and revokes their sessions
+func (r *UserRepo) Disable(uid int64, reason string) error {
+	return r.setStatus(uid, UserDisabled, reason, nil)
+}
+
+// Activate lifts a suspension or disabled status
+func (r *UserRepo) Activate(uid int64) error {
+	return r.setStatus(uid, UserActive, "", nil)
+}
+
+// SoftDelete marks the user as deleted and revokes their sessions.
+// Deleted users are anonymized by AnonymizeDeleted once DeletedUserRetention has passed.
+func (r *UserRepo) SoftDelete(uid int64, reason string) error {
+	return r.setStatus(uid, UserDeleted, reason, nil)
+}
+
+func (r *UserRepo) setStatus(uid int64, status UserStatus, reason string, until *time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := r.setStatusTx(tx, uid, status, reason, until); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setStatusTx changes the status of the user within the transaction, recording an event and audit entry
+func (r *UserRepo) setStatusTx(tx orm.QuerierExecuter, uid int64, status UserStatus, reason string, until *time.Time) error {
+	res, err := tx.Exec(`update users set
+			status = $1,
+			status_reason = $2,
+			suspended_until = $3,
+			deleted_at = case when $1 = 'deleted' then coalesce(deleted_at, now()) else null end
+		where id = $4`, status, reason, until, uid)
+
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUserNotFound
+	}
+
+	if status != UserActive {
+		if err := orm.Exec(tx, "delete from sessions where user_id = $1", uid); err != nil {
+			return err
+		}
+	}
+
+	payload := map[string]any{"user_id": uid, "status": status, "reason": reason, "until": until}
+	if err := addEvent(tx, EventUserStatusChanged, &uid, payload); err != nil {
+		return err
+	}
+
+	return r.audit.add(tx, r.auditEntry(AuditUserStatusChanged, &uid, payload))
+}
+
+// AnonymizeDeleted scrubs personal data of users deleted more than retention ago.
+// The user row is kept for referential integrity with its email replaced by a placeholder.
+// Audit entries, events and webhook deliveries are redacted as EraseUser does,
+// and group memberships, permissions, acl entries and quota usage are removed.
+// Returns the amount of users anonymized.
+func (r *UserRepo) AnonymizeDeleted(retention time.Duration) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`select id from users where status = $1 and anonymized_at is null and deleted_at < $2 for update`,
+		UserDeleted, time.Now().Add(-retention))
+
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	if err := scrubUsers(tx, r.audit, ids); err != nil {
+		return 0, err
+	}
+
+	stmts := []string{
+		`update users set
+			name = '',
+			username = '',
+			email = 'deleted-' || id || '@anonymized.invalid',
+			email_canonical = 'deleted-' || id || '@anonymized.invalid',
+			phone = '',
+			password = '',
+			phone_confirmed_at = null,
+			attributes = '{}',
+			anonymized_at = now()
+		where id = any($1)`,
+		"delete from pass_tokens where user_id = any($1)",
+		"delete from registration_tokens where user_id = any($1)",
+		"delete from phone_codes where user_id = any($1)",
+		"delete from user_devices where user_id = any($1)",
+		"delete from login_attempts where user_id = any($1)",
+		"delete from group_users where user_id = any($1)",
+		"delete from user_permissions where user_id = any($1)",
+		"delete from acl_entries where user_id = any($1)",
+		"delete from quota_usage where user_id = any($1)",
+	}
+
+	for _, sql := range stmts {
+		if err := orm.Exec(tx, sql, ids); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
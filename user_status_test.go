@@ -0,0 +1,34 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cristosal/auth"
+)
+
+func TestUserCheckStatus(t *testing.T) {
+	var (
+		past   = time.Now().Add(-time.Hour)
+		future = time.Now().Add(time.Hour)
+	)
+
+	tt := []struct {
+		user     auth.User
+		expected error
+	}{
+		{auth.User{Status: auth.UserActive}, nil},
+		{auth.User{Status: auth.UserSuspended, SuspendedUntil: &future}, auth.ErrUserSuspended},
+		{auth.User{Status: auth.UserSuspended, SuspendedUntil: &past}, nil},
+		{auth.User{Status: auth.UserSuspended}, auth.ErrUserSuspended},
+		{auth.User{Status: auth.UserDisabled}, auth.ErrUserDisabled},
+		{auth.User{Status: auth.UserDeleted}, auth.ErrUserDeleted},
+	}
+
+	for _, tc := range tt {
+		if err := tc.user.CheckStatus(); !errors.Is(err, tc.expected) {
+			t.Fatalf("expected %v for status %s got %v", tc.expected, tc.user.Status, err)
+		}
+	}
+}
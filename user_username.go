@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/cristosal/orm"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ByUsername returns a user by username, ignoring case and confusable characters
+func (r *UserRepo) ByUsername(username string) (*User, error) {
+	username, err := NormalizeUsername(username)
+	if errors.Is(err, ErrInvalidUsername) || errors.Is(err, ErrUsernameReserved) {
+		return nil, ErrUserNotFound
+	}
+
+	var u User
+	if err := orm.Get(r.db, &u, "where username <> '' and lower(username) = lower($1)", username); err != nil {
+		if errors.Is(err, orm.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+// ByIdentifier returns a user by email when the identifier contains an @, otherwise by username
+func (r *UserRepo) ByIdentifier(identifier string) (*User, error) {
+	if strings.Contains(identifier, "@") {
+		return r.ByEmail(identifier)
+	}
+
+	return r.ByUsername(identifier)
+}
+
+// SetUsername normalizes and sets the username of a user. An empty username removes it.
+// Returns ErrUsernameTaken when another user has a username which is equal after normalization.
+func (r *UserRepo) SetUsername(uid int64, username string) (string, error) {
+	if strings.TrimSpace(username) == "" {
+		username = ""
+	} else {
+		normalized, err := NormalizeUsername(username)
+		if err != nil {
+			return "", err
+		}
+
+		username = normalized
+	}
+
+	if username != "" {
+		if taken, err := r.usernameTaken(r.db, username, uid); err != nil {
+			return "", err
+		} else if taken {
+			return "", ErrUsernameTaken
+		}
+	}
+
+	res, err := r.db.Exec("update users set username = $1 where id = $2", username, uid)
+	if err != nil {
+		if isUniqueViolation(err, "users_username_idx") {
+			err = ErrUsernameTaken
+		}
+
+		return "", err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", ErrUserNotFound
+	}
+
+	return username, nil
+}
+
+// usernameTaken reports whether a user other than uid has the username
+func (r *UserRepo) usernameTaken(db orm.Querier, username string, uid int64) (bool, error) {
+	var taken bool
+	row := db.QueryRow("select exists (select 1 from users where username <> '' and lower(username) = lower($1) and id <> $2)", username, uid)
+	if err := row.Scan(&taken); err != nil {
+		return false, err
+	}
+
+	return taken, nil
+}
+
+// isUniqueViolation reports whether err is a unique violation of the constraint or index
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == constraint
+}
+
+// isForeignKeyViolation reports whether err is a foreign key violation of the constraint
+func isForeignKeyViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503" && pgErr.ConstraintName == constraint
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	// UsernameMinLength is the minimum number of characters in a username
+	UsernameMinLength = 3
+
+	// UsernameMaxLength is the maximum number of characters in a username
+	UsernameMaxLength = 32
+
+	// ReservedUsernames can not be taken by users. Names are compared case-insensitively.
+	ReservedUsernames = []string{
+		"abuse", "admin", "administrator", "api", "auth", "help", "hostmaster", "info",
+		"login", "logout", "me", "null", "postmaster", "register", "root", "security",
+		"settings", "signup", "support", "system", "undefined", "webmaster", "www",
+	}
+)
+
+// confusables maps characters that look like ascii letters or digits to their ascii counterpart
+var confusables = map[rune]rune{
+	// cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'i', 'ј': 'j', 'ԁ': 'd',
+	'ԛ': 'q', 'ԝ': 'w',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O', 'Р': 'P',
+	'С': 'C', 'Т': 'T', 'У': 'Y', 'Х': 'X', 'Ѕ': 'S', 'І': 'I', 'Ј': 'J',
+	// greek
+	'α': 'a', 'ο': 'o', 'ν': 'v', 'τ': 't', 'ι': 'i', 'κ': 'k', 'ρ': 'p', 'υ': 'u',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M',
+	'Ν': 'N', 'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+	// latin
+	'ɡ': 'g', 'ı': 'i', 'ł': 'l', 'ø': 'o', 'đ': 'd', 'ħ': 'h',
+}
+
+// NormalizeUsername returns the canonical form of a username.
+// Compatibility characters are folded with NFKC and characters that look like ascii
+// are replaced with their ascii counterpart, so that names which look alike are equal.
+// Usernames may contain ascii letters, digits, underscores, dots and dashes,
+// must start and end with a letter or digit and can not repeat separators.
+// Returns ErrInvalidUsername or ErrUsernameReserved when the name is not allowed.
+func NormalizeUsername(name string) (string, error) {
+	name = norm.NFKC.String(strings.TrimSpace(name))
+	name = strings.Map(func(r rune) rune {
+		if c, ok := confusables[r]; ok {
+			return c
+		}
+
+		return r
+	}, name)
+
+	if n := utf8.RuneCountInString(name); n < UsernameMinLength || n > UsernameMaxLength {
+		return "", ErrInvalidUsername
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case isAlphaNum(c):
+		case c == '_' || c == '.' || c == '-':
+			if i == 0 || i == len(name)-1 || !isAlphaNum(name[i-1]) {
+				return "", ErrInvalidUsername
+			}
+		default:
+			return "", ErrInvalidUsername
+		}
+	}
+
+	for _, reserved := range ReservedUsernames {
+		if strings.EqualFold(name, reserved) {
+			return "", ErrUsernameReserved
+		}
+	}
+
+	return name, nil
+}
+
+func isAlphaNum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,42 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cristosal/auth"
+)
+
+func TestNormalizeUsername(t *testing.T) {
+	tt := []struct {
+		input    string
+		expected string
+		err      error
+	}{
+		{" john_doe ", "john_doe", nil},
+		{"John.Doe-99", "John.Doe-99", nil},
+		{"ｊｏｈｎ", "john", nil},     // fullwidth
+		{"jоhn", "john", nil},     // cyrillic o
+		{"РауРаl", "PayPal", nil}, // cyrillic
+		{"jo", "", auth.ErrInvalidUsername},
+		{"_john", "", auth.ErrInvalidUsername},
+		{"john_", "", auth.ErrInvalidUsername},
+		{"jo..hn", "", auth.ErrInvalidUsername},
+		{"john doe", "", auth.ErrInvalidUsername},
+		{"jöhn", "", auth.ErrInvalidUsername},
+		{"john@example", "", auth.ErrInvalidUsername},
+		{"Admin", "", auth.ErrUsernameReserved},
+		{"аdmin", "", auth.ErrUsernameReserved}, // cyrillic a
+	}
+
+	for _, tc := range tt {
+		got, err := auth.NormalizeUsername(tc.input)
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("%q: expected error %v got %v", tc.input, tc.err, err)
+		}
+
+		if got != tc.expected {
+			t.Fatalf("%q: expected %q got %q", tc.input, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+
+	// WebhookAllEvents subscribes a webhook to every event type
+	WebhookAllEvents = "*"
+)
+
+type WebhookStatus string
+
+const (
+	WebhookPending   WebhookStatus = "pending"
+	WebhookDelivered WebhookStatus = "delivered"
+	WebhookDead      WebhookStatus = "dead"
+	WebhookSkipped   WebhookStatus = "skipped" // the webhook was inactive when the delivery was due
+)
+
+// Webhook is an endpoint receiving auth events of a given type as signed json posts
+type Webhook struct {
+	ID        int64
+	URL       string
+	Secret    string `json:"-"`
+	EventType EventType
+	Active    bool
+	CreatedAt time.Time `db:"created_at,ro"`
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// WebhookDelivery records the delivery of an event to a webhook
+type WebhookDelivery struct {
+	ID             int64
+	WebhookID      int64
+	EventID        *int64
+	EventType      EventType
+	Payload        json.RawMessage
+	Status         WebhookStatus
+	Attempts       int
+	ResponseStatus int
+	LastError      string
+	NextAttemptAt  time.Time
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// WebhookPayload is the json body posted to webhooks
+type WebhookPayload struct {
+	ID        int64           `json:"id"`
+	Type      EventType       `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// SignWebhook returns the signature of a webhook body sent at the given timestamp.
+// The signature is the hex encoded HMAC-SHA256 of "{timestamp}.{body}" prefixed with sha256=
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the signature and timestamp headers of a received webhook.
+// Timestamps older than tolerance are rejected to prevent replays.
+func VerifyWebhook(secret, signature, timestamp string, body []byte, tolerance time.Duration) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if d := time.Since(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+		return ErrSignatureExpired
+	}
+
+	expected := SignWebhook(secret, ts, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// WebhookRepo manages webhook endpoints and their deliveries
+type WebhookRepo struct{ db orm.DB }
+
+func NewWebhookRepo(db orm.DB) *WebhookRepo {
+	return &WebhookRepo{db}
+}
+
+// Add registers a webhook. A secret is generated when empty
+func (r *WebhookRepo) Add(w *Webhook) error {
+	if w.URL == "" {
+		return ErrURLRequired
+	}
+
+	if w.EventType == "" {
+		w.EventType = WebhookAllEvents
+	}
+
+	if w.Secret == "" {
+		secret, err := GenerateToken(32)
+		if err != nil {
+			return err
+		}
+
+		w.Secret = secret
+	}
+
+	return orm.Add(r.db, w)
+}
+
+// Update updates the url, secret, event type and active flag of a webhook
+func (r *WebhookRepo) Update(w *Webhook) error {
+	return orm.UpdateByID(r.db, w)
+}
+
+// Remove deletes a webhook along with its deliveries
+func (r *WebhookRepo) Remove(id int64) error {
+	return orm.Exec(r.db, "delete from webhooks where id = $1", id)
+}
+
+// ByID returns a webhook by id
+func (r *WebhookRepo) ByID(id int64) (*Webhook, error) {
+	var w Webhook
+	if err := orm.Get(r.db, &w, "where id = $1", id); err != nil {
+		if errors.Is(err, orm.ErrNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+// List returns all webhooks
+func (r *WebhookRepo) List() ([]Webhook, error) {
+	var hooks []Webhook
+	if err := orm.List(r.db, &hooks, "order by id asc"); err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+// Deliveries returns the delivery history of a webhook, most recent first
+func (r *WebhookRepo) Deliveries(webhookID int64, limit, offset int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := orm.List(r.db, &deliveries, "where webhook_id = $1 order by id desc limit $2 offset $3", webhookID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// DeadLetters returns deliveries which exceeded the maximum amount of attempts, most recent first
+func (r *WebhookRepo) DeadLetters(limit, offset int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := orm.List(r.db, &deliveries, "where status = $1 order by id desc limit $2 offset $3", WebhookDead, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver schedules a delivery to be sent again, including dead letters and skipped deliveries
+func (r *WebhookRepo) Redeliver(deliveryID int64) error {
+	return orm.Exec(r.db, "update webhook_deliveries set status = $1, attempts = 0, next_attempt_at = now() where id = $2",
+		WebhookPending, deliveryID)
+}
+
+// Sink returns an EventSink which enqueues a delivery for every active webhook subscribed to the event type.
+// Use it with an EventDispatcher and run a WebhookDispatcher to send the deliveries.
+func (r *WebhookRepo) Sink() EventSink {
+	return EventSinkFunc(func(ctx context.Context, e *Event) error {
+		body, err := json.Marshal(&WebhookPayload{
+			ID:        e.ID,
+			Type:      e.Type,
+			CreatedAt: e.CreatedAt,
+			Data:      e.Payload,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		// events can be sent more than once, deliveries are unique per webhook and event
+		return orm.Exec(r.db, `insert into webhook_deliveries (webhook_id, event_id, event_type, payload)
+			select id, $1, $2, $3 from webhooks where active and (event_type = $2 or event_type = $4)
+			on conflict (webhook_id, event_id) do nothing`, e.ID, e.Type, body, WebhookAllEvents)
+	})
+}
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cristosal/orm"
+)
+
+const (
+	WebhookBatchSize   = 50
+	WebhookMaxAttempts = 8
+	WebhookTimeout     = time.Second * 10
+	WebhookLease       = time.Minute * 15
+)
+
+// WebhookDispatcher posts pending webhook deliveries.
+// Deliveries failing MaxAttempts times are moved to the dead letter list.
+// Deliveries of inactive webhooks are skipped.
+type WebhookDispatcher struct {
+	db          orm.DB
+	Client      *http.Client
+	BatchSize   int
+	MaxAttempts int
+	Backoff     func(attempts int) time.Duration
+	Lease       time.Duration // claimed deliveries are retried after the lease if the dispatcher dies mid batch
+}
+
+// NewWebhookDispatcher returns a dispatcher with default client, batch size, attempts and backoff
+func NewWebhookDispatcher(db orm.DB) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		db:          db,
+		Client:      &http.Client{Timeout: WebhookTimeout},
+		BatchSize:   WebhookBatchSize,
+		MaxAttempts: WebhookMaxAttempts,
+		Backoff:     ExponentialBackoff(time.Second*10, time.Hour*6),
+		Lease:       WebhookLease,
+	}
+}
+
+type webhookJob struct {
+	WebhookDelivery
+	URL    string
+	Secret string
+}
+
+// Dispatch claims a batch of due deliveries and posts them.
+// Deliveries are claimed by pushing their next attempt past the lease, no transaction is held while posting.
+// When the context is cancelled the remaining deliveries are released without counting an attempt.
+// Returns the number of successful deliveries.
+func (d *WebhookDispatcher) Dispatch(ctx context.Context) (int, error) {
+	err := orm.Exec(d.db, `update webhook_deliveries d set status = $1, last_error = 'webhook inactive'
+		from webhooks w where w.id = d.webhook_id and d.status = $2 and not w.active`, WebhookSkipped, WebhookPending)
+
+	if err != nil {
+		return 0, err
+	}
+
+	cols := orm.Columns(&WebhookDelivery{}).PrefixedList("d")
+	sql := fmt.Sprintf(`update webhook_deliveries d set next_attempt_at = $1 from webhooks w
+		where w.id = d.webhook_id and d.id in (
+			select d.id from webhook_deliveries d
+			inner join webhooks w on w.id = d.webhook_id
+			where d.status = $2 and d.next_attempt_at <= now() and w.active
+			order by d.id asc limit $3 for update of d skip locked
+		) returning %s, w.url, w.secret`, cols)
+
+	rows, err := d.db.Query(sql, time.Now().Add(d.Lease), WebhookPending, d.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var jobs []webhookJob
+	for rows.Next() {
+		var j webhookJob
+		err := rows.Scan(&j.ID, &j.WebhookID, &j.EventID, &j.EventType, &j.Payload, &j.Status, &j.Attempts,
+			&j.ResponseStatus, &j.LastError, &j.NextAttemptAt, &j.CreatedAt, &j.DeliveredAt, &j.URL, &j.Secret)
+
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		jobs = append(jobs, j)
+	}
+
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, err
+	}
+
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].ID < jobs[k].ID })
+
+	delivered := 0
+	for i := range jobs {
+		j := &jobs[i]
+		status, err := d.post(ctx, j)
+		if err == nil {
+			err = orm.Exec(d.db, "update webhook_deliveries set status = $1, attempts = attempts + 1, response_status = $2, last_error = '', delivered_at = now() where id = $3",
+				WebhookDelivered, status, j.ID)
+
+			if err != nil {
+				return delivered, err
+			}
+
+			delivered++
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return delivered, d.release(jobs[i:], ctx.Err())
+		}
+
+		next := WebhookPending
+		if j.Attempts+1 >= d.MaxAttempts {
+			next = WebhookDead
+		}
+
+		err = orm.Exec(d.db, "update webhook_deliveries set status = $1, attempts = attempts + 1, response_status = $2, last_error = $3, next_attempt_at = $4 where id = $5",
+			next, status, err.Error(), time.Now().Add(d.Backoff(j.Attempts+1)), j.ID)
+
+		if err != nil {
+			return delivered, err
+		}
+	}
+
+	return delivered, nil
+}
+
+// release makes claimed deliveries due again, returning err unless releasing fails
+func (d *WebhookDispatcher) release(jobs []webhookJob, err error) error {
+	ids := make([]int64, len(jobs))
+	for i := range jobs {
+		ids[i] = jobs[i].ID
+	}
+
+	if rerr := orm.Exec(d.db, "update webhook_deliveries set next_attempt_at = now() where id = any($1) and status = $2", ids, WebhookPending); rerr != nil {
+		return rerr
+	}
+
+	return err
+}
+
+// Run dispatches deliveries every interval until the context is cancelled
+func (d *WebhookDispatcher) Run(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		n, err := d.Dispatch(ctx)
+		if err != nil {
+			return err
+		}
+
+		if n == d.BatchSize && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// post sends the signed delivery returning the response status code.
+// Any non 2xx response is considered an error.
+func (d *WebhookDispatcher) post(ctx context.Context, j *webhookJob) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.URL, bytes.NewReader(j.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, string(j.EventType))
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(j.ID, 10))
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(j.Secret, ts, j.Payload))
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected response status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
@@ -0,0 +1,297 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cristosal/auth"
+)
+
+func TestWebhookPost(t *testing.T) {
+	var (
+		secret = "shhh"
+		body   = []byte(`{"id":1,"type":"user.registered"}`)
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		sig := r.Header.Get(auth.WebhookSignatureHeader)
+		ts := r.Header.Get(auth.WebhookTimestampHeader)
+
+		if err := auth.VerifyWebhook(secret, sig, ts, data, time.Minute); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if auth.EventType(r.Header.Get(auth.WebhookEventHeader)) != auth.EventUserRegistered {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	defer srv.Close()
+
+	d := auth.NewWebhookDispatcher(nil)
+	status, err := d.PostWebhook(context.Background(), srv.URL, secret, auth.EventUserRegistered, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != http.StatusNoContent {
+		t.Fatalf("expected 204 got %d", status)
+	}
+
+	// wrong secret is rejected by the receiver
+	status, err = d.PostWebhook(context.Background(), srv.URL, "wrong", auth.EventUserRegistered, body)
+	if err == nil || status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 error got %d %v", status, err)
+	}
+}
+
+func TestVerifyWebhookExpired(t *testing.T) {
+	var (
+		body = []byte("{}")
+		ts   = time.Now().Add(-time.Hour).Unix()
+		sig  = auth.SignWebhook("secret", ts, body)
+	)
+
+	err := auth.VerifyWebhook("secret", sig, strconv.FormatInt(ts, 10), body, time.Minute*5)
+	if !errors.Is(err, auth.ErrSignatureExpired) {
+		t.Fatalf("expected signature expired got %v", err)
+	}
+
+	err = auth.VerifyWebhook("secret", sig, strconv.FormatInt(ts, 10), body, time.Hour*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// enqueueWebhook registers a user and dispatches the outbox to the webhooks sink
+func enqueueWebhook(t *testing.T, svc *auth.Service, email string) {
+	res, err := svc.Users().Register(&auth.RegistrationRequest{Name: "Webhook User", Email: email, Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { svc.EraseUser(res.UserID) })
+
+	d := svc.Dispatcher(svc.Webhooks().Sink())
+	d.BatchSize = 10000
+	if _, err := d.Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func addTestWebhook(t *testing.T, svc *auth.Service, url string) *auth.Webhook {
+	w := auth.Webhook{URL: url, EventType: auth.EventUserRegistered, Active: true}
+	if err := svc.Webhooks().Add(&w); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { svc.Webhooks().Remove(w.ID) })
+	return &w
+}
+
+func webhookDeliveries(t *testing.T, svc *auth.Service, id int64) []auth.WebhookDelivery {
+	deliveries, err := svc.Webhooks().Deliveries(id, 10000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deliveries) == 0 {
+		t.Fatal("expected deliveries")
+	}
+
+	return deliveries
+}
+
+func TestWebhookDispatcherRetry(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// every delivery fails once before succeeding
+	seen := make(map[string]bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(auth.WebhookDeliveryHeader)
+		if !seen[id] {
+			seen[id] = true
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	defer srv.Close()
+
+	hook := addTestWebhook(t, svc, srv.URL)
+	enqueueWebhook(t, svc, "webhook-retry@example.com")
+
+	d := svc.WebhookDispatcher()
+	d.BatchSize = 10000
+	d.Backoff = func(attempts int) time.Duration {
+		if attempts != 1 {
+			t.Fatalf("expected backoff for first attempt got %d", attempts)
+		}
+
+		return 0
+	}
+
+	if n, err := d.Dispatch(context.Background()); err != nil || n != 0 {
+		t.Fatalf("expected no deliveries got %d %v", n, err)
+	}
+
+	for _, del := range webhookDeliveries(t, svc, hook.ID) {
+		if del.Status != auth.WebhookPending || del.Attempts != 1 || del.ResponseStatus != http.StatusInternalServerError {
+			t.Fatalf("expected pending delivery after failure got %+v", del)
+		}
+	}
+
+	if _, err := d.Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, del := range webhookDeliveries(t, svc, hook.ID) {
+		if del.Status != auth.WebhookDelivered || del.Attempts != 2 || del.DeliveredAt == nil {
+			t.Fatalf("expected delivered after retry got %+v", del)
+		}
+	}
+}
+
+func TestWebhookDispatcherDeadLetter(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	defer srv.Close()
+
+	hook := addTestWebhook(t, svc, srv.URL)
+	enqueueWebhook(t, svc, "webhook-dead@example.com")
+
+	d := svc.WebhookDispatcher()
+	d.BatchSize = 10000
+	d.MaxAttempts = 2
+	d.Backoff = func(int) time.Duration { return 0 }
+
+	for i := 0; i < 3; i++ {
+		if _, err := d.Dispatch(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deliveries := webhookDeliveries(t, svc, hook.ID)
+	for _, del := range deliveries {
+		if del.Status != auth.WebhookDead || del.Attempts != 2 {
+			t.Fatalf("expected dead letter after 2 attempts got %+v", del)
+		}
+	}
+
+	dead, err := svc.Webhooks().DeadLetters(10000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := 0
+	for _, del := range dead {
+		if del.WebhookID == hook.ID {
+			found++
+		}
+	}
+
+	if found != len(deliveries) {
+		t.Fatalf("expected %d dead letters got %d", len(deliveries), found)
+	}
+
+	if err := svc.Webhooks().Redeliver(deliveries[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	redelivered := webhookDeliveries(t, svc, hook.ID)[0]
+	if redelivered.Status != auth.WebhookPending || redelivered.Attempts != 1 {
+		t.Fatalf("expected redelivery to be retried got %+v", redelivered)
+	}
+}
+
+func TestWebhookDispatcherInactive(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("inactive webhook should not be posted")
+	}))
+
+	defer srv.Close()
+
+	hook := addTestWebhook(t, svc, srv.URL)
+	enqueueWebhook(t, svc, "webhook-inactive@example.com")
+
+	hook.Active = false
+	if err := svc.Webhooks().Update(hook); err != nil {
+		t.Fatal(err)
+	}
+
+	d := svc.WebhookDispatcher()
+	d.BatchSize = 10000
+	if _, err := d.Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, del := range webhookDeliveries(t, svc, hook.ID) {
+		if del.Status != auth.WebhookSkipped {
+			t.Fatalf("expected skipped delivery got %+v", del)
+		}
+	}
+}
+
+func TestWebhookDispatcherCancelled(t *testing.T) {
+	svc := NewTestService(t)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		<-r.Context().Done()
+	}))
+
+	defer srv.Close()
+
+	hook := addTestWebhook(t, svc, srv.URL)
+	enqueueWebhook(t, svc, "webhook-cancelled@example.com")
+
+	d := svc.WebhookDispatcher()
+	d.BatchSize = 10000
+	d.MaxAttempts = 1
+
+	if _, err := d.Dispatch(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation got %v", err)
+	}
+
+	for _, del := range webhookDeliveries(t, svc, hook.ID) {
+		if del.Status != auth.WebhookPending || del.Attempts != 0 || del.NextAttemptAt.After(time.Now()) {
+			t.Fatalf("expected cancelled delivery to be released without an attempt got %+v", del)
+		}
+	}
+}